@@ -0,0 +1,206 @@
+package mnemo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// CallerLocal is code in the same process.
+	CallerLocal CallerKind = "local"
+	// CallerWebsocket is a client of a Server's websocket.
+	CallerWebsocket CallerKind = "websocket"
+)
+
+type (
+	// CallerKind is where a command execution came from.
+	CallerKind string
+	// Caller is the identity that executed a command.
+	Caller struct {
+		Kind CallerKind `json:"kind"`
+		// Principal is the identity given by the server's authenticator, if any.
+		Principal string `json:"principal,omitempty"`
+	}
+	// AuditEntry records a single command execution.
+	AuditEntry struct {
+		Seq     uint64     `json:"seq"`
+		Command CommandKey `json:"command"`
+		Args    any        `json:"args,omitempty"`
+		Caller  Caller     `json:"caller"`
+		Start   time.Time  `json:"start"`
+		End     time.Time  `json:"end"`
+		Result  any        `json:"result,omitempty"`
+		Error   string     `json:"error,omitempty"`
+	}
+	// AuditFilter selects audit entries. Zero fields match every entry.
+	AuditFilter struct {
+		Command   CommandKey
+		Principal string
+		Since     time.Time
+		Until     time.Time
+		// Failed selects only executions that returned an error.
+		Failed bool
+	}
+	// AuditConfig configures an audit log.
+	AuditConfig struct {
+		// Limit is the number of entries kept in memory. All are kept if it is 0.
+		Limit int
+		// Writer receives every entry as a line of json when it is recorded.
+		Writer io.Writer
+	}
+	// AuditLog is an append-only log of command executions.
+	AuditLog struct {
+		mu      sync.Mutex
+		cfg     AuditConfig
+		entries []AuditEntry
+		seq     uint64
+	}
+	// callerKey is the context key of a command's caller.
+	callerKey struct{}
+)
+
+// WithAuditLimit sets the number of entries an audit log keeps in memory.
+func WithAuditLimit(n int) Opt[AuditConfig] {
+	return func(c *AuditConfig) {
+		c.Limit = n
+	}
+}
+
+// WithAuditWriter appends every entry of an audit log to w as NDJSON.
+func WithAuditWriter(w io.Writer) Opt[AuditConfig] {
+	return func(c *AuditConfig) {
+		c.Writer = w
+	}
+}
+
+// WithCaller returns a context that executes commands as caller.
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the caller of a command, which is local code
+// unless the context was given another caller.
+func CallerFromContext(ctx context.Context) Caller {
+	if c, ok := ctx.Value(callerKey{}).(Caller); ok {
+		return c
+	}
+	return Caller{Kind: CallerLocal}
+}
+
+// NewAuditLog creates a new audit log.
+func NewAuditLog(opts ...Opt[AuditConfig]) *AuditLog {
+	l := &AuditLog{}
+	for _, o := range opts {
+		o(&l.cfg)
+	}
+	return l
+}
+
+// Middleware records every execution of a command in the log.
+func (l *AuditLog) Middleware() Middleware {
+	return func(key CommandKey, next CommandHandler) CommandHandler {
+		return func(ctx context.Context, args any) (result any, err error) {
+			e := AuditEntry{
+				Command: key,
+				Args:    args,
+				Caller:  CallerFromContext(ctx),
+				Start:   time.Now(),
+			}
+			defer func() {
+				// record panics before they are recovered
+				if p := recover(); p != nil {
+					v := p
+					if cp, ok := p.(*commandPanic); ok {
+						v = cp.value
+					}
+					e.Error = fmt.Sprintf("command '%v' panicked: %v", key, v)
+					l.record(e)
+					panic(p)
+				}
+				e.Result = result
+				if err != nil {
+					e.Error = err.Error()
+				}
+				l.record(e)
+			}()
+			return next(ctx, args)
+		}
+	}
+}
+
+// record appends an entry to the log and its writer.
+func (l *AuditLog) record(e AuditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	e.Seq = l.seq
+	e.End = time.Now()
+	l.entries = append(l.entries, e)
+	if l.cfg.Limit > 0 && len(l.entries) > l.cfg.Limit {
+		l.entries = l.entries[len(l.entries)-l.cfg.Limit:]
+	}
+	if l.cfg.Writer == nil {
+		return
+	}
+	if err := writeAuditEntry(l.cfg.Writer, e); err != nil {
+		NewError[AuditLog](err.Error()).Log()
+	}
+}
+
+// Entries returns the entries of the log matched by filter in the order they were recorded.
+func (l *AuditLog) Entries(filter AuditFilter) []AuditEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var entries []AuditEntry
+	for _, e := range l.entries {
+		if filter.match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Export writes the entries of the log matched by filter to w as NDJSON.
+func (l *AuditLog) Export(w io.Writer, filter AuditFilter) error {
+	for _, e := range l.Entries(filter) {
+		if err := writeAuditEntry(w, e); err != nil {
+			return NewError[AuditLog](err.Error())
+		}
+	}
+	return nil
+}
+
+// writeAuditEntry writes an entry as a line of json. Arguments and results that
+// cannot be encoded are replaced by their printed value.
+func writeAuditEntry(w io.Writer, e AuditEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		e.Args = fmt.Sprintf("%v", e.Args)
+		e.Result = fmt.Sprintf("%v", e.Result)
+		if b, err = json.Marshal(e); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func (f AuditFilter) match(e AuditEntry) bool {
+	switch {
+	case f.Command != "" && e.Command != f.Command:
+		return false
+	case f.Principal != "" && e.Caller.Principal != f.Principal:
+		return false
+	case !f.Since.IsZero() && e.Start.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && e.Start.After(f.Until):
+		return false
+	case f.Failed && e.Error == "":
+		return false
+	}
+	return true
+}
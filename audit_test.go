@@ -0,0 +1,189 @@
+package mnemo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAuditLog(t *testing.T) {
+	var key StoreKey = "audit_store"
+	store, _ := NewStore(key)
+	var buf bytes.Buffer
+	audit := store.EnableAudit(WithAuditLimit(3), WithAuditWriter(&buf))
+	if store.EnableAudit() != audit || store.Audit() != audit {
+		t.Fatal("expected store to keep a single audit log")
+	}
+	cmds := store.Commands()
+	cmds.Register("double", Handler(func(ctx context.Context, n int) (int, error) {
+		return n * 2, nil
+	}))
+	cmds.Register("fail", func(ctx context.Context, args any) (any, error) {
+		return nil, errors.New("failed")
+	})
+	cmds.Assign(map[CommandKey]func(){
+		"panic": func() { panic("boom") },
+	})
+
+	start := time.Now()
+	cmds.Execute(context.Background(), "double", 2)
+	cmds.Execute(WithCaller(context.Background(), Caller{Kind: CallerWebsocket, Principal: "ann"}), "fail", nil)
+	cmds.Execute(context.Background(), "panic", nil)
+
+	entries := audit.Entries(AuditFilter{})
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries; got %+v", entries)
+	}
+	e := entries[0]
+	if e.Seq != 1 || e.Command != "double" || e.Args != 2 || e.Result != 4 || e.Caller.Kind != CallerLocal {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if e.Start.Before(start) || e.End.Before(e.Start) {
+		t.Errorf("unexpected entry times %v %v", e.Start, e.End)
+	}
+	if f := audit.Entries(AuditFilter{Principal: "ann"}); len(f) != 1 || f[0].Error != "failed" {
+		t.Errorf("expected entry of caller; got %+v", f)
+	}
+	if f := audit.Entries(AuditFilter{Failed: true}); len(f) != 2 || f[1].Command != "panic" {
+		t.Errorf("expected failed and panicked entries; got %+v", f)
+	}
+	if e := entries[2]; e.Error != "command 'panic' panicked: boom" {
+		t.Errorf("expected panic value to be recorded; got %q", e.Error)
+	}
+	if f := audit.Entries(AuditFilter{Since: time.Now()}); len(f) != 0 {
+		t.Errorf("expected no entries since now; got %+v", f)
+	}
+
+	// the log keeps the last entries in memory
+	cmds.Execute(context.Background(), "double", 3)
+	if entries := audit.Entries(AuditFilter{}); len(entries) != 3 || entries[0].Seq != 2 {
+		t.Errorf("expected oldest entry to be dropped; got %+v", entries)
+	}
+
+	// the writer receives every entry
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		lines++
+		if e.Seq != uint64(lines) {
+			t.Errorf("expected entries in order; got %d at line %d", e.Seq, lines)
+		}
+	}
+	if lines != 4 {
+		t.Errorf("expected 4 entries written; got %d", lines)
+	}
+
+	var out bytes.Buffer
+	if err := audit.Export(&out, AuditFilter{Command: "double"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(out.Bytes(), []byte("\n")); n != 1 {
+		t.Errorf("expected 1 exported entry; got %d", n)
+	}
+}
+
+func TestAuditWebsocket(t *testing.T) {
+	var key StoreKey = "audit_ws_store"
+	store, _ := NewStore(key)
+	audit := store.EnableAudit()
+	store.Commands().Register("greet", Handler(func(ctx context.Context, name string) (string, error) {
+		return "hello " + name, nil
+	}), WithRemote())
+	store.Commands().Register("local", func(ctx context.Context, args any) (any, error) {
+		return nil, nil
+	})
+	m := New().WithServer("audit", WithPort(8212), WithSilence(), WithAuthenticator(func(r *http.Request) (string, error) {
+		if token := r.Header.Get("Authorization"); token != "" {
+			return token, nil
+		}
+		return "", errors.New("missing token")
+	}))
+	m.WithStores(key)
+	m.Server().ListenAndServe()
+	t.Cleanup(func() { m.Server().Shutdown() })
+
+	var resp *http.Response
+	waitForNoError(t, func() error {
+		var err error
+		_, resp, err = websocket.DefaultDialer.Dial(m.Server().URL()+"/subscribe", nil)
+		if resp == nil {
+			return err
+		}
+		return nil
+	})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected unauthenticated connection to be rejected; got %d", resp.StatusCode)
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial(m.Server().URL()+"/subscribe", http.Header{"Authorization": {"bob"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.WriteJSON(map[string]any{"type": "execute", "id": "c1", "store": key, "command": "greet", "args": "bob"})
+	ws.WriteJSON(map[string]any{"type": "execute", "id": "c2", "store": key, "command": "local"})
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	for received := 0; received < 2; {
+		var resp CommandResponse
+		if err := ws.ReadJSON(&resp); err != nil {
+			t.Fatal(err)
+		}
+		switch resp.ID {
+		case "c1":
+			if resp.Error != "" || resp.Result != "hello bob" {
+				t.Errorf("unexpected response %+v", resp)
+			}
+		case "c2":
+			if !strings.Contains(resp.Error, "cannot be executed remotely") {
+				t.Errorf("expected command without WithRemote to be rejected; got %+v", resp)
+			}
+		default:
+			continue
+		}
+		received++
+	}
+	entries := audit.Entries(AuditFilter{Principal: "bob"})
+	if len(entries) != 1 || entries[0].Caller.Kind != CallerWebsocket {
+		t.Errorf("expected execution by websocket principal; got %+v", entries)
+	}
+}
+
+func TestAuthenticateHandlers(t *testing.T) {
+	m := New().WithServer("auth", WithPort(8216), WithSilence(), WithReplication(), WithInvalidation(), WithPartitioning(), WithAuthenticator(func(r *http.Request) (string, error) {
+		if r.Header.Get("Authorization") == "secret" {
+			return "admin", nil
+		}
+		return "", errors.New("missing token")
+	}))
+	routes := []string{"subscribe", "replicate", "invalidate", "partition", "query", "jobs", "commands", "metrics"}
+	for _, route := range routes {
+		rec := httptest.NewRecorder()
+		m.Server().http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/"+route, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected unauthenticated request to /%s to be rejected; got %d", route, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/auth/metrics", nil)
+	req.Header.Set("Authorization", "secret")
+	m.Server().http.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected authenticated request to be served; got %d", rec.Code)
+	}
+	if metrics := m.Server().Metrics(); metrics.Rejected != uint64(len(routes)) || metrics.Accepted != 1 {
+		t.Errorf("unexpected authentication metrics %+v", metrics)
+	}
+}
@@ -0,0 +1,104 @@
+package mnemo
+
+const (
+	// BatchOK means the write was applied.
+	BatchOK BatchResult = iota
+	// BatchDuplicate means the key already existed and was not cached.
+	BatchDuplicate
+	// BatchMissing means the key did not exist and was not updated or deleted.
+	BatchMissing
+	// BatchFailed means the write was rejected by a unique index or the cache's sink.
+	BatchFailed
+)
+
+type (
+	// BatchResult is the outcome of a single write in a batch.
+	BatchResult int
+)
+
+// String implements the fmt.Stringer interface.
+func (r BatchResult) String() string {
+	switch r {
+	case BatchOK:
+		return "ok"
+	case BatchDuplicate:
+		return "duplicate"
+	case BatchMissing:
+		return "missing"
+	case BatchFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// CacheMany caches data by key under a single lock.
+//
+// Keys that already exist are left unchanged and reported as BatchDuplicate.
+// The whole batch produces a single history entry and feed update.
+func (c *Cache[T]) CacheMany(items map[CacheKey]*T) map[CacheKey]BatchResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	results := make(map[CacheKey]BatchResult, len(items))
+	for key, data := range items {
+		if _, ok := c.raw.caches[key]; ok {
+			results[key] = BatchDuplicate
+			continue
+		}
+		if _, err := c.insert(key, data, sourceLocal); err != nil {
+			results[key] = BatchFailed
+			continue
+		}
+		results[key] = BatchOK
+	}
+	return results
+}
+
+// UpdateMany updates items by key under a single lock.
+//
+// Keys that do not exist are reported as BatchMissing.
+// The whole batch produces a single history entry and feed update.
+func (c *Cache[T]) UpdateMany(updates map[CacheKey]T) map[CacheKey]BatchResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	results := make(map[CacheKey]BatchResult, len(updates))
+	for key, update := range updates {
+		prev, ok := c.raw.caches[key]
+		if !ok {
+			results[key] = BatchMissing
+			continue
+		}
+		update := update
+		if _, err := c.replace(key, prev, &update, sourceLocal); err != nil {
+			results[key] = BatchFailed
+			continue
+		}
+		results[key] = BatchOK
+	}
+	return results
+}
+
+// DeleteMany deletes items by key under a single lock.
+//
+// Keys that do not exist are reported as BatchMissing, and keys passed more
+// than once are deleted once. The whole batch produces a single history entry
+// and feed update.
+func (c *Cache[T]) DeleteMany(keys ...CacheKey) map[CacheKey]BatchResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	results := make(map[CacheKey]BatchResult, len(keys))
+	for _, key := range keys {
+		if _, ok := results[key]; ok {
+			continue
+		}
+		ok, err := c.remove(key, sourceLocal)
+		switch {
+		case err != nil:
+			results[key] = BatchFailed
+		case ok:
+			results[key] = BatchOK
+		default:
+			results[key] = BatchMissing
+		}
+	}
+	return results
+}
@@ -0,0 +1,75 @@
+package mnemo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheMany(t *testing.T) {
+	cache := newCache[int]()
+	one, two := 1, 2
+	cache.Cache("one", &one)
+	results := cache.CacheMany(map[CacheKey]*int{"one": &one, "two": &two})
+	if results["one"] != BatchDuplicate || results["two"] != BatchOK {
+		t.Errorf("unexpected results %v", results)
+	}
+	if len(cache.GetAll()) != 2 {
+		t.Error("expected new key to be cached")
+	}
+}
+
+func TestUpdateMany(t *testing.T) {
+	cache := newCache[int]()
+	one := 1
+	cache.Cache("one", &one)
+	results := cache.UpdateMany(map[CacheKey]int{"one": 10, "two": 20})
+	if results["one"] != BatchOK || results["two"] != BatchMissing {
+		t.Errorf("unexpected results %v", results)
+	}
+	if item, _ := cache.Get("one"); *item.Data != 10 || item.Version != 2 {
+		t.Error("expected existing key to be updated")
+	}
+	if _, ok := cache.Get("two"); ok {
+		t.Error("expected missing key not to be cached")
+	}
+}
+
+func TestDeleteMany(t *testing.T) {
+	cache := newCache[int]()
+	one, two := 1, 2
+	cache.CacheMany(map[CacheKey]*int{"one": &one, "two": &two})
+	results := cache.DeleteMany("one", "three", "one")
+	if results["one"] != BatchOK || results["three"] != BatchMissing {
+		t.Errorf("unexpected results %v", results)
+	}
+	if len(cache.GetAll()) != 1 {
+		t.Error("expected one key to remain")
+	}
+}
+
+func TestBatchSingleFeedUpdate(t *testing.T) {
+	cache := newCache[int]()
+	cache.SetReducer(cache.DefaultReducer)
+	feed := cache.ReducerFeed()
+	<-feed
+
+	items := make(map[CacheKey]*int)
+	for i := 0; i < 500; i++ {
+		v := i
+		items[i] = &v
+	}
+	cache.CacheMany(items)
+	select {
+	case f := <-feed:
+		if len(f.Cache) != 500 {
+			t.Errorf("expected feed update with all items; got %d", len(f.Cache))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected feed update")
+	}
+	select {
+	case <-feed:
+		t.Error("expected a single feed update for the batch")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
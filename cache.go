@@ -1,10 +1,12 @@
 package mnemo
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,13 +17,29 @@ type (
 		createdAt time.Time
 		raw       *raw[T]
 		reducer   *reducer[T]
+		// id orders caches when several are locked at once.
+		id uint64
+		// seq is incremented on every mutation of the raw cache.
+		seq       uint64
+		listeners map[uint64]func(mutation[T])
+		nextID    uint64
+		// changed is signalled after every commit to wake the change monitor.
+		changed chan struct{}
+		loader  *loader[T]
+		sink    *sinkWriter[T]
+		indexes map[string]*index[T]
+		diffs   chan CacheDiff[T]
+		undo    *undoLog[T]
+		metrics cacheMetrics
 	}
 	// raw is a collection of cached data, it's history, and a feed of live updates
 	// prior to reduction.
 	raw[T any] struct {
 		caches  map[CacheKey]*Item[T]
 		history map[time.Time]map[CacheKey]Item[T]
-		feed    chan map[time.Time]map[CacheKey]Item[T]
+		// index orders the times of history entries.
+		index []historyEntry
+		feed  chan map[time.Time]map[CacheKey]Item[T]
 	}
 	// reducer is a collection of reduced data, it's history, and a feed of live updates
 	reducer[T any] struct {
@@ -29,9 +47,14 @@ type (
 		history map[time.Time][]reducerCache[any]
 		feed    chan reducerFeed[any]
 	}
-	// Item holds cached data and the time it was cached.
+	// Item holds cached data, the time it was cached and its version.
+	//
+	// Version starts at 1 when the item is cached and increases by one on
+	// every update.
 	Item[T any] struct {
 		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Version   uint64    `json:"version"`
 		Data      *T        `json:"data"`
 	}
 	// cacheTimeoutConfig is a configuration for caching data with a timeout.
@@ -61,11 +84,63 @@ type (
 		Cache     []reducerCache[U] `json:"cache"`
 	}
 	reducerHistory[T any] reducerFeed[T]
+	// mutation describes a single change to the raw cache.
+	mutation[T any] struct {
+		Op   mutationOp
+		Key  CacheKey
+		Item Item[T]
+		// Prev is the item replaced or deleted by the mutation, if any.
+		Prev   *Item[T]
+		Seq    uint64
+		Source mutationSource
+	}
+	// mutationOp is the kind of change made to the raw cache.
+	mutationOp string
+	// mutationSource identifies where a mutation originated.
+	mutationSource int
 )
 
+const (
+	opCache  mutationOp = "cache"
+	opUpdate mutationOp = "update"
+	opDelete mutationOp = "delete"
+)
+
+const (
+	// sourceLocal mutations are made through the Cache API.
+	sourceLocal mutationSource = iota
+	// sourceRemote mutations are applied on behalf of another Mnemo instance.
+	sourceRemote
+	// sourceLoader mutations cache items loaded from the source of truth.
+	sourceLoader
+	// sourceExpiry mutations remove items that have timed out.
+	sourceExpiry
+	// sourceSynced mutations are local mutations a transaction has already checked
+	// against unique indexes and written through to the cache's sink.
+	// Listeners see them as sourceLocal.
+	sourceSynced
+)
+
+// String returns the name of the source.
+func (s mutationSource) String() string {
+	switch s {
+	case sourceRemote:
+		return "remote"
+	case sourceLoader:
+		return "loader"
+	case sourceExpiry:
+		return "expiry"
+	}
+	return "local"
+}
+
+// cacheIDs assigns each cache a unique id.
+var cacheIDs atomic.Uint64
+
 // newCache is an internal implementation of NewCache
 func newCache[T any]() (data *Cache[T]) {
 	c := &Cache[T]{
+		id:        cacheIDs.Add(1),
 		createdAt: time.Now(),
 		raw: &raw[T]{
 			caches:  make(map[CacheKey]*Item[T]),
@@ -76,51 +151,71 @@ func newCache[T any]() (data *Cache[T]) {
 			history: make(map[time.Time][]reducerCache[any]),
 			feed:    make(chan reducerFeed[any], 1024),
 		},
+		listeners: make(map[uint64]func(mutation[T])),
+		changed:   make(chan struct{}, 1),
 	}
 	return c
 }
 
 // monitorChanges monitors changes to the raw cache and caches the raw cache and it's reduction.
+//
+// The monitor wakes after each commit, so changes committed together under a
+// single lock, such as a transaction, are recorded as a single history entry.
 func (c *Cache[T]) monitorChanges(setup chan bool) {
 	// cache initial state and confirm setup is complete
-	pRaw := c.copyRaw()
+	pRaw, seq := c.copyRaw()
 	setup <- true
 
 	prev := c.reduce(pRaw)
 	t := time.Now()
-	c.cacheRaw(t, pRaw)
+	c.cacheRaw(t, seq, pRaw)
 	c.cacheReduction(t, prev)
-	for {
-		raw := c.copyRaw()
+	last := Snapshot[T]{CreatedAt: t, Seq: seq, Raw: pRaw, Reduced: prev}
+	for range c.changed {
+		raw, seq := c.copyRaw()
+		_, span := startSpan(context.Background(), "mnemo.cache.reduce", Attr("items", len(raw)), Attr("seq", seq))
+		start := time.Now()
 		current := c.reduce(raw)
+		c.metrics.reductions.Add(1)
+		c.metrics.reduceNanos.Add(uint64(time.Since(start)))
 		// TODO: Maybe be able to reduce this to a single comparison
 		// by converting the reduced cache to a string
-		if !reflect.DeepEqual(prev, current) {
+		changed := !reflect.DeepEqual(prev, current)
+		span.SetAttributes(Attr("changed", changed))
+		span.End()
+		if changed {
 			t := time.Now()
-			c.cacheRaw(t, raw)
+			c.cacheRaw(t, seq, raw)
 			c.cacheReduction(t, current)
-			prev = current
+			next := Snapshot[T]{CreatedAt: t, Seq: seq, Raw: raw, Reduced: current}
+			c.publishDiff(last, next)
+			prev, last = current, next
 		}
 	}
 }
 
-// copyRaw copies the raw cache.
-func (c *Cache[T]) copyRaw() map[CacheKey]Item[T] {
+// copyRaw copies the raw cache and returns the sequence number of its last mutation.
+func (c *Cache[T]) copyRaw() (map[CacheKey]Item[T], uint64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	copy := make(map[CacheKey]Item[T])
 	for k, v := range c.raw.caches {
 		copy[k] = *v
 	}
-	return copy
+	return copy, c.seq
 }
 
 // cacheRaw caches the raw cache.
-func (c *Cache[T]) cacheRaw(t time.Time, copy map[CacheKey]Item[T]) {
+func (c *Cache[T]) cacheRaw(t time.Time, seq uint64, copy map[CacheKey]Item[T]) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.raw.history[t] = copy
-	c.raw.feed <- c.raw.history
+	c.raw.index = append(c.raw.index, historyEntry{at: t, seq: seq})
+	select {
+	case c.raw.feed <- c.raw.history:
+	default:
+		c.metrics.rawDropped.Add(1)
+	}
 }
 
 // newCacheReducer wraps a user defined reducer function with reducerCache meta data.
@@ -152,20 +247,32 @@ func (c *Cache[T]) reduce(copy map[CacheKey]Item[T]) []reducerCache[any] {
 		})
 	}
 	reduce := *c.reducer.reduce
-	return reduce(data)
+	r := reduce(data)
+	sortReduction(r)
+	return r
+}
+
+// sortReduction sorts a reduced cache by creation time, then by key.
+func sortReduction(r []reducerCache[any]) {
+	sort.SliceStable(r, func(i, j int) bool {
+		if !r[i].CreatedAt.Equal(r[j].CreatedAt) {
+			return r[i].CreatedAt.Before(r[j].CreatedAt)
+		}
+		return fmt.Sprint(r[i].Key) < fmt.Sprint(r[j].Key)
+	})
 }
 
 // cacheReduction caches the reduced cache.
 func (c *Cache[T]) cacheReduction(t time.Time, r []reducerCache[any]) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	//sort by createdAt
-	sort.Slice(r, func(i, j int) bool {
-		return r[i].CreatedAt.Before(r[j].CreatedAt)
-	})
 	c.reducer.history[t] = r
 	rf := reducerFeed[any]{CreatedAt: t, Cache: r}
-	c.reducer.feed <- rf
+	select {
+	case c.reducer.feed <- rf:
+	default:
+		c.metrics.reducDropped.Add(1)
+	}
 }
 
 // SetReducer sets the user defined reducer function and starts monitoring changes.
@@ -211,14 +318,18 @@ func (c *Cache[T]) RawHistory() map[time.Time]map[CacheKey]Item[T] {
 	return c.raw.history
 }
 
-// ReducerHistory returns the reduced cache history.
+// ReducerHistory returns the reduced cache history, oldest first.
 func (c *Cache[T]) ReducerHistory() []reducerHistory[any] {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	rh := []reducerHistory[any]{}
-	for time, cache := range c.reducer.history {
+	for _, e := range c.raw.index {
+		cache, ok := c.reducer.history[e.at]
+		if !ok {
+			continue
+		}
 		rh = append(rh, reducerHistory[any]{
-			CreatedAt: time,
+			CreatedAt: e.at,
 			Cache:     cache,
 		})
 	}
@@ -230,8 +341,12 @@ func (c *Cache[T]) Get(key CacheKey) (Item[T], bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	data := c.raw.caches[key]
-	if data == nil {
+	_, span := startSpan(context.Background(), "mnemo.cache.get", Attr("key", key))
+	defer span.End()
+	data, ok := c.lookup(key)
+	c.metrics.countLookup(ok)
+	span.SetAttributes(Attr("hit", ok))
+	if !ok {
 		return *new(Item[T]), false
 	}
 	return *data, true
@@ -256,12 +371,8 @@ func (c *Cache[T]) Cache(key CacheKey, data *T) error {
 	if c.raw.caches[key] != nil {
 		return fmt.Errorf("duplicate cache key: %v", key)
 	}
-	item := &Item[T]{
-		Data:      data,
-		CreatedAt: time.Now(),
-	}
-	c.raw.caches[key] = item
-	return nil
+	_, err := c.insert(key, data, sourceLocal)
+	return err
 }
 
 // TODO: Convert to option
@@ -280,9 +391,11 @@ func (c *Cache[T]) CacheWithTimeout(cfg cacheTimeoutConfig[T]) error {
 		if !ok {
 			logger.Fatalf("could not get cache with key %v", cfg.key)
 		}
-		err := c.Delete(cfg.key)
+		c.mu.Lock()
+		_, err := c.remove(cfg.key, sourceExpiry)
+		c.mu.Unlock()
 		if err != nil {
-			NewError[Cache[T]](err.Error())
+			NewError[Cache[T]](err.Error()).Log()
 			return
 		}
 		cfg.timeoutFun(item.Data)
@@ -300,10 +413,143 @@ func (c *Cache[T]) Update(key CacheKey, update T) bool {
 		return false
 	}
 	//TODO: ensure this is being updated in reducer
-	c.raw.caches[key] = &Item[T]{Data: &update, CreatedAt: prev.CreatedAt}
+	if _, err := c.replace(key, prev, &update, sourceLocal); err != nil {
+		NewError[Cache[T]](err.Error()).Log()
+		return false
+	}
 	return true
 }
 
+// CompareAndSwap updates an item only if its version is expectedVersion.
+//
+// An expectedVersion of 0 caches the item only if the key does not exist.
+// It returns false if the version does not match, or an error if the key does not exist.
+func (c *Cache[T]) CompareAndSwap(key CacheKey, expectedVersion uint64, update T) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev, ok := c.raw.caches[key]
+	if expectedVersion == 0 {
+		if ok {
+			return false, nil
+		}
+		if _, err := c.insert(key, &update, sourceLocal); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if !ok {
+		return false, fmt.Errorf("no cache with key: %v", key)
+	}
+	if prev.Version != expectedVersion {
+		return false, nil
+	}
+	if _, err := c.replace(key, prev, &update, sourceLocal); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateFunc atomically replaces an item with the result of fn applied to its current value.
+//
+// The cache is locked while fn runs, so fn must not call back into the cache.
+// It returns an error if the key does not exist or fn returns an error, in which
+// case the item is left unchanged.
+func (c *Cache[T]) UpdateFunc(key CacheKey, fn func(old T) (T, error)) (Item[T], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev, ok := c.raw.caches[key]
+	if !ok {
+		return *new(Item[T]), fmt.Errorf("no cache with key: %v", key)
+	}
+	var old T
+	if prev.Data != nil {
+		old = *prev.Data
+	}
+	update, err := fn(old)
+	if err != nil {
+		return *prev, err
+	}
+	item, err := c.replace(key, prev, &update, sourceLocal)
+	if err != nil {
+		return *prev, err
+	}
+	return item, nil
+}
+
+// Set caches data by key, replacing any existing item.
+//
+// It returns true if the key was inserted and false if an existing item was
+// replaced, or an error if the write was rejected and nothing was stored.
+func (c *Cache[T]) Set(key CacheKey, data T) (inserted bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if prev, ok := c.raw.caches[key]; ok {
+		_, err := c.replace(key, prev, &data, sourceLocal)
+		return false, err
+	}
+	if _, err := c.insert(key, &data, sourceLocal); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Add caches data by key only if the key does not exist.
+//
+// It returns false if an item with the key already exists, or an error if the
+// write was rejected.
+func (c *Cache[T]) Add(key CacheKey, data T) (inserted bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.raw.caches[key]; ok {
+		return false, nil
+	}
+	if _, err := c.insert(key, &data, sourceLocal); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Replace replaces an existing item only if the key exists.
+//
+// It returns false if no item with the key exists, or an error if the write
+// was rejected.
+func (c *Cache[T]) Replace(key CacheKey, data T) (replaced bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev, ok := c.raw.caches[key]
+	if !ok {
+		return false, nil
+	}
+	if _, err := c.replace(key, prev, &data, sourceLocal); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetOrCreate returns the item cached by key, caching the result of fn if the key does not exist.
+//
+// The cache is locked while fn runs, so fn must not call back into the cache.
+// It returns true if the item was created, or an error if the write was
+// rejected and nothing was stored.
+func (c *Cache[T]) GetOrCreate(key CacheKey, fn func() T) (item Item[T], created bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if prev, ok := c.raw.caches[key]; ok {
+		return *prev, false, nil
+	}
+	data := fn()
+	if item, err = c.insert(key, &data, sourceLocal); err != nil {
+		return *new(Item[T]), false, err
+	}
+	return item, true, nil
+}
+
 // Delete deletes a cache by key.
 func (c *Cache[T]) Delete(key interface{}) error {
 	c.mu.Lock()
@@ -312,10 +558,147 @@ func (c *Cache[T]) Delete(key interface{}) error {
 	if c.raw.caches[key] == nil {
 		return fmt.Errorf("no cache with key: %v", key)
 	}
-	delete(c.raw.caches, key)
+	_, err := c.remove(key, sourceLocal)
+	return err
+}
+
+// commit records a mutation of the raw cache and notifies listeners.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) commit(op mutationOp, key CacheKey, item Item[T], prev *Item[T], src mutationSource) {
+	if src == sourceSynced {
+		src = sourceLocal
+	}
+	c.updateIndexes(op, key, item)
+	c.metrics.countRemoval(op, src)
+	c.seq++
+	m := mutation[T]{Op: op, Key: key, Item: item, Prev: prev, Seq: c.seq, Source: src}
+	for _, fn := range c.listeners {
+		fn(m)
+	}
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// insert caches new data at version 1.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) insert(key CacheKey, data *T, src mutationSource) (item Item[T], err error) {
+	span := c.startMutation("mnemo.cache.insert", key, src)
+	defer func() { endMutation(span, err) }()
+	now := time.Now()
+	item = Item[T]{CreatedAt: now, UpdatedAt: now, Version: 1, Data: data}
+	if err := c.checkIndexes(key, data, src); err != nil {
+		return *new(Item[T]), err
+	}
+	if err := c.propagate(opCache, key, item, src); err != nil {
+		return *new(Item[T]), err
+	}
+	c.raw.caches[key] = &item
+	c.commit(opCache, key, item, nil, src)
+	return item, nil
+}
+
+// replace replaces the data of an existing item and advances its version.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) replace(key CacheKey, prev *Item[T], data *T, src mutationSource) (item Item[T], err error) {
+	span := c.startMutation("mnemo.cache.update", key, src)
+	defer func() { endMutation(span, err) }()
+	item = Item[T]{
+		CreatedAt: prev.CreatedAt,
+		UpdatedAt: time.Now(),
+		Version:   prev.Version + 1,
+		Data:      data,
+	}
+	if err := c.checkIndexes(key, data, src); err != nil {
+		return *prev, err
+	}
+	if err := c.propagate(opUpdate, key, item, src); err != nil {
+		return *prev, err
+	}
+	c.raw.caches[key] = &item
+	c.commit(opUpdate, key, item, prev, src)
+	return item, nil
+}
+
+// put stores an item, replacing any item with the same key.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) put(key CacheKey, item Item[T], src mutationSource) (err error) {
+	op, name := opCache, "mnemo.cache.insert"
+	prev, ok := c.raw.caches[key]
+	if ok {
+		op, name = opUpdate, "mnemo.cache.update"
+	}
+	span := c.startMutation(name, key, src)
+	defer func() { endMutation(span, err) }()
+	if err := c.checkIndexes(key, item.Data, src); err != nil {
+		return err
+	}
+	if err := c.propagate(op, key, item, src); err != nil {
+		return err
+	}
+	c.raw.caches[key] = &item
+	c.commit(op, key, item, prev, src)
 	return nil
 }
 
+// remove deletes an item and reports whether it existed.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) remove(key CacheKey, src mutationSource) (removed bool, err error) {
+	prev, ok := c.raw.caches[key]
+	if !ok {
+		return false, nil
+	}
+	span := c.startMutation("mnemo.cache.delete", key, src)
+	defer func() { endMutation(span, err) }()
+	if err := c.propagate(opDelete, key, *prev, src); err != nil {
+		return false, err
+	}
+	delete(c.raw.caches, key)
+	c.commit(opDelete, key, *prev, prev, src)
+	return true, nil
+}
+
+// startMutation starts the span of a mutation of the raw cache.
+func (c *Cache[T]) startMutation(name string, key CacheKey, src mutationSource) Span {
+	_, span := startSpan(context.Background(), name, Attr("key", key), Attr("source", src.String()))
+	return span
+}
+
+// endMutation ends the span of a mutation, recording the error that failed it.
+func endMutation(span Span, err error) {
+	span.RecordError(err)
+	span.End()
+}
+
+// listen registers a function called on every mutation of the raw cache and
+// returns a function that removes it.
+//
+// Listeners are called while the cache is locked, so they must not block or
+// call back into the cache.
+func (c *Cache[T]) listen(fn func(mutation[T])) (cancel func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.listenLocked(fn)
+}
+
+// listenLocked is listen for callers already holding c.mu.
+func (c *Cache[T]) listenLocked(fn func(mutation[T])) (cancel func()) {
+	c.nextID++
+	id := c.nextID
+	c.listeners[id] = fn
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.listeners, id)
+	}
+}
+
 // NewCacheTimeoutConfig creates a new cacheTimeoutConfig.
 // TODO: Convert to option
 func NewCacheTimeoutConfig[T any](
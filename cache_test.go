@@ -1,7 +1,10 @@
 package mnemo
 
 import (
+	"errors"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -125,3 +128,127 @@ func TestDelete(t *testing.T) {
 		t.Error("expected invalid key error after item already deleted")
 	}
 }
+
+func TestItemVersion(t *testing.T) {
+	cache := newCache[int]()
+	one := 1
+	cache.Cache("one", &one)
+	item, _ := cache.Get("one")
+	if item.Version != 1 || !item.UpdatedAt.Equal(item.CreatedAt) {
+		t.Errorf("expected new item at version 1; got %d", item.Version)
+	}
+	cache.Update("one", 2)
+	item, _ = cache.Get("one")
+	if item.Version != 2 || item.UpdatedAt.Before(item.CreatedAt) {
+		t.Errorf("expected update to advance version to 2; got %d", item.Version)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	cache := newCache[int]()
+	ok, err := cache.CompareAndSwap("one", 0, 1)
+	if !ok || err != nil {
+		t.Errorf("expected version 0 to cache missing key; got %v, %v", ok, err)
+	}
+	ok, _ = cache.CompareAndSwap("one", 0, 1)
+	if ok {
+		t.Error("expected version 0 to fail for existing key")
+	}
+	ok, _ = cache.CompareAndSwap("one", 2, 10)
+	if ok {
+		t.Error("expected stale version to fail")
+	}
+	ok, _ = cache.CompareAndSwap("one", 1, 10)
+	item, _ := cache.Get("one")
+	if !ok || *item.Data != 10 || item.Version != 2 {
+		t.Error("expected matching version to swap")
+	}
+	_, err = cache.CompareAndSwap("missing", 1, 1)
+	if err == nil {
+		t.Error("expected missing key error")
+	}
+}
+
+func TestUpdateFunc(t *testing.T) {
+	cache := newCache[int]()
+	zero := 0
+	cache.Cache("count", &zero)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.UpdateFunc("count", func(old int) (int, error) { return old + 1, nil })
+		}()
+	}
+	wg.Wait()
+	item, _ := cache.Get("count")
+	if *item.Data != 100 || item.Version != 101 {
+		t.Errorf("expected 100 at version 101; got %d at version %d", *item.Data, item.Version)
+	}
+
+	_, err := cache.UpdateFunc("count", func(old int) (int, error) {
+		return 0, errors.New("rejected")
+	})
+	item, _ = cache.Get("count")
+	if err == nil || *item.Data != 100 {
+		t.Error("expected failed update to leave item unchanged")
+	}
+}
+
+func TestSet(t *testing.T) {
+	cache := newCache[int]()
+	if inserted, err := cache.Set("one", 1); !inserted || err != nil {
+		t.Error("expected missing key to be inserted")
+	}
+	if inserted, err := cache.Set("one", 2); inserted || err != nil {
+		t.Error("expected existing key to be replaced")
+	}
+	if item, _ := cache.Get("one"); *item.Data != 2 || item.Version != 2 {
+		t.Error("expected replaced value at version 2")
+	}
+}
+
+func TestAddReplace(t *testing.T) {
+	cache := newCache[int]()
+	if replaced, _ := cache.Replace("one", 1); replaced {
+		t.Error("expected replace of missing key to fail")
+	}
+	if inserted, _ := cache.Add("one", 1); !inserted {
+		t.Error("expected add of missing key to succeed")
+	}
+	if inserted, _ := cache.Add("one", 2); inserted {
+		t.Error("expected add of existing key to fail")
+	}
+	if replaced, _ := cache.Replace("one", 3); !replaced {
+		t.Error("expected replace of existing key to succeed")
+	}
+	if item, _ := cache.Get("one"); *item.Data != 3 {
+		t.Errorf("expected 3; got %d", *item.Data)
+	}
+}
+
+func TestGetOrCreate(t *testing.T) {
+	cache := newCache[int]()
+	var calls atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.GetOrCreate("one", func() int {
+				calls.Add(1)
+				return 1
+			})
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("expected create func to run once; ran %d times", calls.Load())
+	}
+	item, created, err := cache.GetOrCreate("one", func() int { return 2 })
+	if created || err != nil || *item.Data != 1 {
+		t.Error("expected existing item to be returned")
+	}
+}
@@ -0,0 +1,125 @@
+package mnemo
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type (
+	// wireKey is a CacheKey encoded for transport between Mnemo instances.
+	//
+	// Keys are tagged with their kind so that an int key is still an int
+	// once decoded on the other side.
+	wireKey struct {
+		Kind  string          `json:"k"`
+		Value json.RawMessage `json:"v"`
+	}
+	// wireItem is a cached item encoded for transport between Mnemo instances.
+	wireItem struct {
+		Key  wireKey         `json:"key"`
+		Item json.RawMessage `json:"item"`
+	}
+)
+
+// encodeKey encodes a CacheKey for transport.
+//
+// Keys of other kinds are encoded as plain json and decoded as
+// whatever encoding/json produces for them.
+func encodeKey(key any) (wireKey, error) {
+	var kind string
+	switch key.(type) {
+	case string:
+		kind = "string"
+	case int:
+		kind = "int"
+	case int8:
+		kind = "int8"
+	case int16:
+		kind = "int16"
+	case int32:
+		kind = "int32"
+	case int64:
+		kind = "int64"
+	case uint:
+		kind = "uint"
+	case uint8:
+		kind = "uint8"
+	case uint16:
+		kind = "uint16"
+	case uint32:
+		kind = "uint32"
+	case uint64:
+		kind = "uint64"
+	case float32:
+		kind = "float32"
+	case float64:
+		kind = "float64"
+	case bool:
+		kind = "bool"
+	case StoreKey:
+		kind = "store"
+	case CommandKey:
+		kind = "command"
+	default:
+		kind = "json"
+	}
+	b, err := json.Marshal(key)
+	if err != nil {
+		return wireKey{}, NewError[wireKey](fmt.Sprintf("could not encode key '%v': %v", key, err))
+	}
+	return wireKey{Kind: kind, Value: b}, nil
+}
+
+// decodeKey decodes a CacheKey encoded with encodeKey.
+func decodeKey(w wireKey) (any, error) {
+	var (
+		key any
+		err error
+	)
+	switch w.Kind {
+	case "string":
+		key, err = decodeAs[string](w.Value)
+	case "int":
+		key, err = decodeAs[int](w.Value)
+	case "int8":
+		key, err = decodeAs[int8](w.Value)
+	case "int16":
+		key, err = decodeAs[int16](w.Value)
+	case "int32":
+		key, err = decodeAs[int32](w.Value)
+	case "int64":
+		key, err = decodeAs[int64](w.Value)
+	case "uint":
+		key, err = decodeAs[uint](w.Value)
+	case "uint8":
+		key, err = decodeAs[uint8](w.Value)
+	case "uint16":
+		key, err = decodeAs[uint16](w.Value)
+	case "uint32":
+		key, err = decodeAs[uint32](w.Value)
+	case "uint64":
+		key, err = decodeAs[uint64](w.Value)
+	case "float32":
+		key, err = decodeAs[float32](w.Value)
+	case "float64":
+		key, err = decodeAs[float64](w.Value)
+	case "bool":
+		key, err = decodeAs[bool](w.Value)
+	case "store":
+		key, err = decodeAs[StoreKey](w.Value)
+	case "command":
+		key, err = decodeAs[CommandKey](w.Value)
+	default:
+		key, err = decodeAs[any](w.Value)
+	}
+	if err != nil {
+		return nil, NewError[wireKey](fmt.Sprintf("could not decode key '%s': %v", w.Value, err))
+	}
+	return key, nil
+}
+
+func decodeAs[T any](b json.RawMessage) (T, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
@@ -1,51 +1,393 @@
 package mnemo
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
 	"sync"
+	"time"
 )
 
 type (
 	// CommandKey is a unique identifier for a command.
 	CommandKey string
+	// CommandHandler runs a command with its arguments and returns its result.
+	CommandHandler func(ctx context.Context, args any) (any, error)
+	// CommandConfig configures a command.
+	CommandConfig struct {
+		// Timeout bounds each execution of the command. There is no timeout if it is 0.
+		Timeout time.Duration
+		// Middleware wraps the command inside the collection's middleware.
+		Middleware []Middleware
+		// Description describes what the command does.
+		Description string
+		// Args is the schema arguments are validated against before the command runs.
+		Args *Schema
+		// Result is the schema of the command's result.
+		Result *Schema
+		// Remote allows websocket clients of a server to execute the command.
+		Remote bool
+	}
+	// CommandInfo describes a command to callers.
+	CommandInfo struct {
+		Key         CommandKey    `json:"key"`
+		Description string        `json:"description,omitempty"`
+		Args        *Schema       `json:"args,omitempty"`
+		Result      *Schema       `json:"result,omitempty"`
+		Timeout     time.Duration `json:"timeout,omitempty"`
+		Remote      bool          `json:"remote,omitempty"`
+	}
 	// Commands is a collection of commands.
 	Commands struct {
-		mu   sync.Mutex
-		list map[CommandKey]func()
+		mu         sync.Mutex
+		list       map[CommandKey]*command
+		middleware []Middleware
+		jobs       *jobRunner
+		schedules  map[ScheduleID]*schedule
+		metrics    map[CommandKey]*commandMetrics
+	}
+	// command is a registered command handler and its configuration.
+	command struct {
+		handler CommandHandler
+		cfg     CommandConfig
+	}
+	// CommandRequest executes a command of a store over a websocket connection.
+	CommandRequest struct {
+		Type    string          `json:"type"`
+		ID      string          `json:"id,omitempty"`
+		Store   StoreKey        `json:"store"`
+		Command CommandKey      `json:"command"`
+		Args    json.RawMessage `json:"args,omitempty"`
+	}
+	// CommandResponse is the outcome of a CommandRequest.
+	CommandResponse struct {
+		Type   string `json:"type"`
+		ID     string `json:"id,omitempty"`
+		Result any    `json:"result,omitempty"`
+		Error  string `json:"error,omitempty"`
+	}
+	// commandResult is the outcome of a command run in the background.
+	commandResult struct {
+		result any
+		err    error
+		panic  *commandPanic
 	}
 )
 
-// NewCommands creates a new collection of commands.
+// WithCommandTimeout bounds each execution of a command.
+func WithCommandTimeout(d time.Duration) Opt[CommandConfig] {
+	return func(c *CommandConfig) {
+		c.Timeout = d
+	}
+}
+
+// WithMiddleware wraps a command with middleware, which runs inside the
+// middleware of the collection in the order given.
+func WithMiddleware(mw ...Middleware) Opt[CommandConfig] {
+	return func(c *CommandConfig) {
+		c.Middleware = append(c.Middleware, mw...)
+	}
+}
+
+// WithDescription describes what a command does.
+func WithDescription(description string) Opt[CommandConfig] {
+	return func(c *CommandConfig) {
+		c.Description = description
+	}
+}
+
+// WithArgsSchema validates the arguments of a command against schema before it runs.
+func WithArgsSchema(schema *Schema) Opt[CommandConfig] {
+	return func(c *CommandConfig) {
+		c.Args = schema
+	}
+}
+
+// WithResultSchema describes the result of a command with schema.
+func WithResultSchema(schema *Schema) Opt[CommandConfig] {
+	return func(c *CommandConfig) {
+		c.Result = schema
+	}
+}
+
+// WithRemote allows websocket clients of a server to execute a command.
+// Commands can only be executed locally by default.
+func WithRemote() Opt[CommandConfig] {
+	return func(c *CommandConfig) {
+		c.Remote = true
+	}
+}
+
+// WithSchemas describes the arguments and result of a command with the schemas
+// of A and R, as used by Handler.
+func WithSchemas[A, R any]() Opt[CommandConfig] {
+	return func(c *CommandConfig) {
+		c.Args = SchemaOf[A]()
+		c.Result = SchemaOf[R]()
+	}
+}
+
+// NewCommands creates a new collection of commands. Panics in its commands are
+// recovered and returned as errors.
 func NewCommands() Commands {
 	return Commands{
-		list: make(map[CommandKey]func()),
+		list:       make(map[CommandKey]*command),
+		middleware: []Middleware{Recover()},
+	}
+}
+
+// Handler adapts a function with typed arguments and result to a CommandHandler.
+//
+// Arguments that are not of type A, such as json decoded from a client, are
+// converted to A through json.
+func Handler[A, R any](fn func(ctx context.Context, args A) (R, error)) CommandHandler {
+	return func(ctx context.Context, args any) (any, error) {
+		a, err := convertArgs[A](args)
+		if err != nil {
+			return nil, err
+		}
+		return fn(ctx, a)
 	}
 }
 
-// Assign assigns a map of commands to the collection.
+// convertArgs converts command arguments to A.
+func convertArgs[A any](args any) (A, error) {
+	var a A
+	switch v := args.(type) {
+	case A:
+		return v, nil
+	case nil:
+		return a, nil
+	case json.RawMessage:
+		if err := json.Unmarshal(v, &a); err != nil {
+			return a, NewError[Commands](fmt.Sprintf("invalid arguments: %v", err))
+		}
+		return a, nil
+	}
+	b, err := json.Marshal(args)
+	if err == nil {
+		err = json.Unmarshal(b, &a)
+	}
+	if err != nil {
+		return a, NewError[Commands](fmt.Sprintf("invalid arguments: %v", err))
+	}
+	return a, nil
+}
+
+// Assign assigns a map of commands without arguments or results to the collection.
+// Commands with arguments or results, such as pipelines, are added with Register.
 func (c *Commands) Assign(cmds map[CommandKey]func()) {
+	for k, v := range cmds {
+		fn := v
+		c.Register(k, func(ctx context.Context, args any) (any, error) {
+			fn()
+			return nil, nil
+		})
+	}
+}
+
+// Register adds a command handler to the collection, replacing any command with the same key.
+func (c *Commands) Register(key CommandKey, handler CommandHandler, opts ...Opt[CommandConfig]) {
+	cmd := &command{handler: handler}
+	for _, o := range opts {
+		o(&cmd.cfg)
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	for k, v := range cmds {
-		c.list[k] = v
+	c.list[key] = cmd
+}
+
+// Execute executes a command with args and returns its result, or an error if
+// the command does not exist, fails or is not done before ctx or its timeout.
+//
+// Commands run outside the collection's lock, so they may run concurrently and
+// may execute other commands.
+func (c *Commands) Execute(ctx context.Context, key CommandKey, args any) (any, error) {
+	cmd, err := c.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.run(ctx, key, cmd, args)
+}
+
+// run runs a command wrapped in the collection's and the command's middleware.
+func (c *Commands) run(ctx context.Context, key CommandKey, cmd *command, args any) (any, error) {
+	c.mu.Lock()
+	mw := c.middleware
+	c.mu.Unlock()
+	h := cmd.run
+	for i := len(cmd.cfg.Middleware) - 1; i >= 0; i-- {
+		h = cmd.cfg.Middleware[i](key, h)
+	}
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](key, h)
+	}
+	ctx, span := startSpan(ctx, "mnemo.command.execute", Attr("command", key))
+	defer span.End()
+	start := time.Now()
+	result, err := h(ctx, args)
+	c.count(key, time.Since(start), err)
+	span.RecordError(err)
+	return result, err
+}
+
+// run runs the command's handler, returning early if ctx or the command's timeout is done.
+//
+// A panic in the handler is raised again in the caller's goroutine, so it can be
+// recovered by middleware.
+func (cmd *command) run(ctx context.Context, args any) (any, error) {
+	if err := cmd.validate(args); err != nil {
+		return nil, err
+	}
+	if cmd.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmd.cfg.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan commandResult, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- commandResult{panic: &commandPanic{value: p, stack: debug.Stack()}}
+			}
+		}()
+		result, err := cmd.handler(ctx, args)
+		done <- commandResult{result: result, err: err}
+	}()
+	select {
+	case r := <-done:
+		if r.panic != nil {
+			panic(r.panic)
+		}
+		return r.result, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
-// Execute executes a command and returns an error if the command does not exist.
-func (c *Commands) Execute(key CommandKey) error {
+// get returns a command by key.
+func (c *Commands) get(key CommandKey) (*command, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	f, ok := c.list[key]
+	cmd, ok := c.list[key]
 	if !ok {
-		return fmt.Errorf("no command with key %v", key)
+		return nil, fmt.Errorf("no command with key %v", key)
+	}
+	return cmd, nil
+}
+
+// Validate validates args against the schema of a command's arguments without running it.
+func (c *Commands) Validate(key CommandKey, args any) error {
+	cmd, err := c.get(key)
+	if err != nil {
+		return err
+	}
+	return cmd.validate(args)
+}
+
+// validate validates args against the command's argument schema.
+func (cmd *command) validate(args any) error {
+	if err := cmd.cfg.Args.Validate(args); err != nil {
+		e, _ := IsErrorType[Schema](err)
+		return NewError[Commands](fmt.Sprintf("invalid arguments: %v", e.Err)).
+			WithStatus(http.StatusBadRequest)
 	}
-	cmd := f
-	cmd()
 	return nil
 }
 
-func (c *Commands) List() map[CommandKey]func() {
+// remote reports whether a command can be executed by websocket clients and
+// whether it exists.
+func (c *Commands) remote(key CommandKey) (remote, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cmd, ok := c.list[key]
+	return ok && cmd.cfg.Remote, ok
+}
+
+// List describes the collection's commands in order of their keys.
+func (c *Commands) List() []CommandInfo {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.list
+	list := make([]CommandInfo, 0, len(c.list))
+	for k, cmd := range c.list {
+		list = append(list, CommandInfo{
+			Key:         k,
+			Description: cmd.cfg.Description,
+			Args:        cmd.cfg.Args,
+			Result:      cmd.cfg.Result,
+			Timeout:     cmd.cfg.Timeout,
+			Remote:      cmd.cfg.Remote,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// HandleCommands responds with the commands of the store given by the 'store' query parameter.
+func (s *Server) HandleCommands(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(StoreKey(r.URL.Query().Get("store")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(store.Commands().List())
+}
+
+// listCommands sends a websocket connection the commands of a store.
+func (s *Server) listCommands(c *Conn, key StoreKey) {
+	msg := struct {
+		Type     string        `json:"type"`
+		Store    StoreKey      `json:"store"`
+		Commands []CommandInfo `json:"commands"`
+		Error    string        `json:"error,omitempty"`
+	}{Type: "commands", Store: key}
+	store, err := s.store(key)
+	if err != nil {
+		msg.Error = err.Error()
+	} else {
+		msg.Commands = store.Commands().List()
+	}
+	c.send(msg)
+}
+
+// handleExecute executes a command sent by a websocket connection as the
+// connection's caller and sends it the response. Only commands registered
+// WithRemote can be executed.
+func (s *Server) handleExecute(ctx context.Context, c *Conn, msg []byte) {
+	var req CommandRequest
+	resp := CommandResponse{Type: "result"}
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = err.Error()
+		c.send(resp)
+		return
+	}
+	resp.ID = req.ID
+	store, err := s.store(req.Store)
+	if err != nil {
+		resp.Error = err.Error()
+		c.send(resp)
+		return
+	}
+	if remote, ok := store.Commands().remote(req.Command); ok && !remote {
+		resp.Error = NewError[Commands](fmt.Sprintf("command '%s' cannot be executed remotely", req.Command)).Error()
+		c.send(resp)
+		return
+	}
+	var args any
+	if len(req.Args) > 0 {
+		args = req.Args
+	}
+	ctx = WithCaller(ctx, Caller{Kind: CallerWebsocket, Principal: c.Principal})
+	resp.Result, err = store.Commands().Execute(ctx, req.Command, args)
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	c.send(resp)
 }
@@ -1,6 +1,12 @@
 package mnemo
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestNewCommands(t *testing.T) {
 	c := NewCommands()
@@ -26,12 +32,100 @@ func TestExecute(t *testing.T) {
 		"test": func() {},
 	}
 	c.Assign(cmds)
-	err := c.Execute("test")
+	_, err := c.Execute(context.Background(), "test", nil)
 	if err != nil {
 		t.Error("expected command to execute")
 	}
-	err = c.Execute("invalid")
+	_, err = c.Execute(context.Background(), "invalid", nil)
 	if err == nil {
 		t.Error("expected command to not execute")
 	}
 }
+
+func TestExecuteResult(t *testing.T) {
+	type sumArgs struct {
+		A, B int
+	}
+	c := NewCommands()
+	c.Register("sum", Handler(func(ctx context.Context, args sumArgs) (int, error) {
+		return args.A + args.B, nil
+	}))
+	result, err := c.Execute(context.Background(), "sum", sumArgs{A: 1, B: 2})
+	if err != nil || result != 3 {
+		t.Errorf("expected result 3; got %v, %v", result, err)
+	}
+	// arguments decoded from json are converted to the handler's type
+	result, _ = c.Execute(context.Background(), "sum", map[string]any{"A": 2.0, "B": 3.0})
+	if result != 5 {
+		t.Errorf("expected converted arguments; got %v", result)
+	}
+	if _, err := c.Execute(context.Background(), "sum", "nope"); err == nil {
+		t.Error("expected error for invalid arguments")
+	}
+
+	errFailed := errors.New("failed")
+	c.Register("fail", func(ctx context.Context, args any) (any, error) {
+		return nil, errFailed
+	})
+	if _, err := c.Execute(context.Background(), "fail", nil); err != errFailed {
+		t.Errorf("expected handler error; got %v", err)
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	c := NewCommands()
+	c.Register("slow", func(ctx context.Context, args any) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, WithCommandTimeout(20*time.Millisecond))
+	c.Register("stuck", func(ctx context.Context, args any) (any, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	})
+
+	if _, err := c.Execute(context.Background(), "slow", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected timeout; got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := c.Execute(ctx, "stuck", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation; got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("expected execute to return when its context is done")
+	}
+}
+
+func TestExecuteConcurrently(t *testing.T) {
+	c := NewCommands()
+	release := make(chan struct{})
+	var calls atomic.Int32
+	c.Register("block", func(ctx context.Context, args any) (any, error) {
+		<-release
+		return nil, nil
+	})
+	c.Register("count", func(ctx context.Context, args any) (any, error) {
+		calls.Add(1)
+		return nil, nil
+	})
+	go c.Execute(context.Background(), "block", nil)
+	time.Sleep(10 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		c.Execute(context.Background(), "count", nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("expected a slow command not to block other commands")
+	}
+	close(release)
+	if calls.Load() != 1 {
+		t.Error("expected command to run")
+	}
+}
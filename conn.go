@@ -1,8 +1,10 @@
 package mnemo
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -15,6 +17,17 @@ type (
 		Pool      *Pool
 		Key       interface{}
 		Messages  chan interface{}
+		// Principal is the identity given by the server's authenticator, if any.
+		Principal string
+		// onMessage is called with every message read from the connection.
+		onMessage func(msg []byte)
+		// ctx holds the span of the subscribe request that opened the connection.
+		ctx    context.Context
+		mu     sync.Mutex
+		closed bool
+		// closing is set when Close takes the onClose hooks.
+		closing bool
+		onClose []func()
 	}
 )
 
@@ -41,16 +54,56 @@ func (c *Conn) Close() error {
 	if c == nil {
 		return NewError[Conn]("connection is nil")
 	}
-	c.Pool.removeConnection(c)
+	c.mu.Lock()
+	c.closing = true
+	hooks := c.onClose
+	c.onClose = nil
+	c.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+	if c.Pool != nil {
+		c.Pool.removeConnection(c)
+	}
 	c.websocket.Close()
 	return nil
 }
 
+// onClosed registers a function called when the Conn is closed. fn is called
+// immediately if the Conn is already closed.
+func (c *Conn) onClosed(fn func()) {
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		fn()
+		return
+	}
+	c.onClose = append(c.onClose, fn)
+	c.mu.Unlock()
+}
+
+// send sends a message to the Conn without blocking and reports whether it was sent.
+// Messages are dropped if the Conn is closed or its buffer is full.
+func (c *Conn) send(msg interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Messages <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
 // Listen listens for messages on the Conn's Messages channel and writes them to the websocket connection.
 func (c *Conn) Listen() {
 	go func(c *Conn) {
 		for {
-			if _, _, err := c.websocket.ReadMessage(); err != nil {
+			_, msg, err := c.websocket.ReadMessage()
+			if err != nil {
 				if websocket.IsUnexpectedCloseError(
 					err,
 					websocket.CloseGoingAway,
@@ -59,9 +112,15 @@ func (c *Conn) Listen() {
 				) {
 					NewError[Conn](err.Error()).Log()
 				}
+				c.mu.Lock()
+				c.closed = true
 				close(c.Messages)
+				c.mu.Unlock()
 				break
 			}
+			if c.onMessage != nil {
+				c.onMessage(msg)
+			}
 		}
 	}(c)
 
@@ -0,0 +1,486 @@
+package mnemo
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// Mergeable is implemented by conflict-free replicated data types.
+	//
+	// Merge must be commutative, associative and idempotent and must not modify
+	// either value. Caches of Mergeable types merge replicated values instead of
+	// overwriting them, so replicas written concurrently converge.
+	Mergeable[T any] interface {
+		Merge(other T) T
+	}
+	// GCounter is a grow-only counter.
+	GCounter struct {
+		Counts map[string]uint64 `json:"counts"`
+	}
+	// PNCounter is a counter that can be incremented and decremented.
+	PNCounter struct {
+		P GCounter `json:"p"`
+		N GCounter `json:"n"`
+	}
+	// Timestamp is a hybrid logical clock timestamp.
+	Timestamp struct {
+		Wall    int64  `json:"wall"`
+		Logical uint32 `json:"logical"`
+		Node    string `json:"node"`
+	}
+	// HLC is a hybrid logical clock.
+	//
+	// Timestamps follow wall time where possible but never go backwards and
+	// always advance past timestamps received from other nodes.
+	HLC struct {
+		mu   sync.Mutex
+		node string
+		last Timestamp
+		now  func() time.Time
+	}
+	// LWWRegister holds a single value where the write with the latest timestamp wins.
+	LWWRegister[T any] struct {
+		Value T         `json:"value"`
+		Time  Timestamp `json:"time"`
+	}
+	// ORSet is an observed-remove set.
+	//
+	// An element is present if any of its add tags has not been removed, so a
+	// concurrent add and remove of the same element resolves in favour of the add.
+	ORSet[E any] struct {
+		Elements   map[string]orElement[E] `json:"elements"`
+		Tombstones map[string]bool         `json:"tombstones"`
+	}
+	orElement[E any] struct {
+		Value E               `json:"value"`
+		Tags  map[string]bool `json:"tags"`
+	}
+	// ORMap is an observed-remove map of mergeable values.
+	//
+	// Keys follow ORSet semantics and values under the same key are merged.
+	ORMap[V Mergeable[V]] struct {
+		Entries    map[string]orEntry[V] `json:"entries"`
+		Tombstones map[string]bool       `json:"tombstones"`
+	}
+	orEntry[V any] struct {
+		Value V               `json:"value"`
+		Tags  map[string]bool `json:"tags"`
+	}
+)
+
+// NewGCounter returns an empty grow-only counter.
+func NewGCounter() GCounter {
+	return GCounter{Counts: make(map[string]uint64)}
+}
+
+// Increment returns a copy of the counter incremented by n on node.
+func (g GCounter) Increment(node string, n uint64) GCounter {
+	next := g.copy()
+	next.Counts[node] += n
+	return next
+}
+
+// Value returns the counter's total.
+func (g GCounter) Value() uint64 {
+	var total uint64
+	for _, n := range g.Counts {
+		total += n
+	}
+	return total
+}
+
+// Merge returns the per-node maximum of both counters.
+func (g GCounter) Merge(other GCounter) GCounter {
+	next := g.copy()
+	for node, n := range other.Counts {
+		if n > next.Counts[node] {
+			next.Counts[node] = n
+		}
+	}
+	return next
+}
+
+func (g GCounter) copy() GCounter {
+	next := NewGCounter()
+	for node, n := range g.Counts {
+		next.Counts[node] = n
+	}
+	return next
+}
+
+// NewPNCounter returns a counter with a value of zero.
+func NewPNCounter() PNCounter {
+	return PNCounter{P: NewGCounter(), N: NewGCounter()}
+}
+
+// Increment returns a copy of the counter incremented by n on node.
+func (c PNCounter) Increment(node string, n uint64) PNCounter {
+	return PNCounter{P: c.P.Increment(node, n), N: c.N.copy()}
+}
+
+// Decrement returns a copy of the counter decremented by n on node.
+func (c PNCounter) Decrement(node string, n uint64) PNCounter {
+	return PNCounter{P: c.P.copy(), N: c.N.Increment(node, n)}
+}
+
+// Value returns the counter's total.
+func (c PNCounter) Value() int64 {
+	return int64(c.P.Value()) - int64(c.N.Value())
+}
+
+// Merge merges the increments and decrements of both counters.
+func (c PNCounter) Merge(other PNCounter) PNCounter {
+	return PNCounter{P: c.P.Merge(other.P), N: c.N.Merge(other.N)}
+}
+
+// Compare returns -1, 0 or 1 if t is before, equal to or after other.
+//
+// Timestamps with equal wall and logical time are ordered by node.
+func (t Timestamp) Compare(other Timestamp) int {
+	switch {
+	case t.Wall != other.Wall:
+		return cmp.Compare(t.Wall, other.Wall)
+	case t.Logical != other.Logical:
+		return cmp.Compare(t.Logical, other.Logical)
+	case t.Node != other.Node:
+		return cmp.Compare(t.Node, other.Node)
+	}
+	return 0
+}
+
+// Before reports whether t is before other.
+func (t Timestamp) Before(other Timestamp) bool {
+	return t.Compare(other) < 0
+}
+
+// NewHLC returns a hybrid logical clock for node.
+func NewHLC(node string) *HLC {
+	return &HLC{node: node, now: time.Now}
+}
+
+// Now returns a timestamp after every timestamp the clock has issued or observed.
+func (c *HLC) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wall := c.now().UnixNano()
+	if wall > c.last.Wall {
+		c.last = Timestamp{Wall: wall, Node: c.node}
+	} else {
+		c.last.Logical++
+	}
+	return c.last
+}
+
+// Update advances the clock past a timestamp received from another node
+// and returns a new timestamp.
+func (c *HLC) Update(remote Timestamp) Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wall := c.now().UnixNano()
+	switch {
+	case wall > c.last.Wall && wall > remote.Wall:
+		c.last = Timestamp{Wall: wall}
+	case c.last.Wall == remote.Wall:
+		c.last.Logical = max(c.last.Logical, remote.Logical) + 1
+	case c.last.Wall > remote.Wall:
+		c.last.Logical++
+	default:
+		c.last = Timestamp{Wall: remote.Wall, Logical: remote.Logical + 1}
+	}
+	c.last.Node = c.node
+	return c.last
+}
+
+// NewLWWRegister returns a register holding v at the clock's current time.
+func NewLWWRegister[T any](v T, clock *HLC) LWWRegister[T] {
+	return LWWRegister[T]{Value: v, Time: clock.Now()}
+}
+
+// Set returns a register holding v at the clock's current time.
+func (r LWWRegister[T]) Set(v T, clock *HLC) LWWRegister[T] {
+	return LWWRegister[T]{Value: v, Time: clock.Update(r.Time)}
+}
+
+// Merge returns the register with the latest timestamp.
+func (r LWWRegister[T]) Merge(other LWWRegister[T]) LWWRegister[T] {
+	if r.Time.Before(other.Time) {
+		return other
+	}
+	return r
+}
+
+// NewORSet returns an empty observed-remove set.
+func NewORSet[E any]() ORSet[E] {
+	return ORSet[E]{
+		Elements:   make(map[string]orElement[E]),
+		Tombstones: make(map[string]bool),
+	}
+}
+
+// Add returns a copy of the set with e added by node.
+// It returns the set unchanged and an error if e cannot be encoded as json.
+func (s ORSet[E]) Add(e E, node string) (ORSet[E], error) {
+	id, err := crdtID(e)
+	if err != nil {
+		return s, err
+	}
+	next := s.copy()
+	el, ok := next.Elements[id]
+	if !ok {
+		el = orElement[E]{Value: e, Tags: make(map[string]bool)}
+	}
+	el.Tags[node+":"+uuid.NewString()] = true
+	next.Elements[id] = el
+	return next, nil
+}
+
+// Remove returns a copy of the set with every observed add of e removed.
+// It returns the set unchanged and an error if e cannot be encoded as json.
+func (s ORSet[E]) Remove(e E) (ORSet[E], error) {
+	id, err := crdtID(e)
+	if err != nil {
+		return s, err
+	}
+	next := s.copy()
+	if el, ok := next.Elements[id]; ok {
+		for tag := range el.Tags {
+			next.Tombstones[tag] = true
+		}
+		delete(next.Elements, id)
+	}
+	return next, nil
+}
+
+// Contains reports whether e is in the set. An element that cannot be encoded
+// as json is never in the set.
+func (s ORSet[E]) Contains(e E) bool {
+	id, err := crdtID(e)
+	if err != nil {
+		return false
+	}
+	_, ok := s.Elements[id]
+	return ok
+}
+
+// Values returns the elements of the set.
+func (s ORSet[E]) Values() []E {
+	values := make([]E, 0, len(s.Elements))
+	for _, el := range s.Elements {
+		values = append(values, el.Value)
+	}
+	return values
+}
+
+// Merge returns the union of both sets' adds less the union of their removes.
+func (s ORSet[E]) Merge(other ORSet[E]) ORSet[E] {
+	next := s.copy()
+	for tag := range other.Tombstones {
+		next.Tombstones[tag] = true
+	}
+	for id, el := range other.Elements {
+		merged, ok := next.Elements[id]
+		if !ok {
+			merged = orElement[E]{Value: el.Value, Tags: make(map[string]bool)}
+		}
+		for tag := range el.Tags {
+			merged.Tags[tag] = true
+		}
+		next.Elements[id] = merged
+	}
+	for id, el := range next.Elements {
+		for tag := range el.Tags {
+			if next.Tombstones[tag] {
+				delete(el.Tags, tag)
+			}
+		}
+		if len(el.Tags) == 0 {
+			delete(next.Elements, id)
+		}
+	}
+	return next
+}
+
+func (s ORSet[E]) copy() ORSet[E] {
+	next := NewORSet[E]()
+	for tag := range s.Tombstones {
+		next.Tombstones[tag] = true
+	}
+	for id, el := range s.Elements {
+		next.Elements[id] = orElement[E]{Value: el.Value, Tags: copyTags(el.Tags)}
+	}
+	return next
+}
+
+// NewORMap returns an empty observed-remove map.
+func NewORMap[V Mergeable[V]]() ORMap[V] {
+	return ORMap[V]{
+		Entries:    make(map[string]orEntry[V]),
+		Tombstones: make(map[string]bool),
+	}
+}
+
+// Put returns a copy of the map with v merged into the value at key by node.
+func (m ORMap[V]) Put(key string, v V, node string) ORMap[V] {
+	next := m.copy()
+	entry, ok := next.Entries[key]
+	if ok {
+		entry.Value = entry.Value.Merge(v)
+	} else {
+		entry = orEntry[V]{Value: v, Tags: make(map[string]bool)}
+	}
+	entry.Tags[node+":"+uuid.NewString()] = true
+	next.Entries[key] = entry
+	return next
+}
+
+// Remove returns a copy of the map with every observed put of key removed.
+func (m ORMap[V]) Remove(key string) ORMap[V] {
+	next := m.copy()
+	if entry, ok := next.Entries[key]; ok {
+		for tag := range entry.Tags {
+			next.Tombstones[tag] = true
+		}
+		delete(next.Entries, key)
+	}
+	return next
+}
+
+// Get returns the value at key.
+func (m ORMap[V]) Get(key string) (V, bool) {
+	entry, ok := m.Entries[key]
+	return entry.Value, ok
+}
+
+// Keys returns the keys present in the map.
+func (m ORMap[V]) Keys() []string {
+	keys := make([]string, 0, len(m.Entries))
+	for k := range m.Entries {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Merge returns the union of both maps with values under the same key merged.
+func (m ORMap[V]) Merge(other ORMap[V]) ORMap[V] {
+	next := m.copy()
+	for tag := range other.Tombstones {
+		next.Tombstones[tag] = true
+	}
+	for key, entry := range other.Entries {
+		merged, ok := next.Entries[key]
+		if ok {
+			merged.Value = merged.Value.Merge(entry.Value)
+		} else {
+			merged = orEntry[V]{Value: entry.Value, Tags: make(map[string]bool)}
+		}
+		for tag := range entry.Tags {
+			merged.Tags[tag] = true
+		}
+		next.Entries[key] = merged
+	}
+	for key, entry := range next.Entries {
+		for tag := range entry.Tags {
+			if next.Tombstones[tag] {
+				delete(entry.Tags, tag)
+			}
+		}
+		if len(entry.Tags) == 0 {
+			delete(next.Entries, key)
+		}
+	}
+	return next
+}
+
+func (m ORMap[V]) copy() ORMap[V] {
+	next := NewORMap[V]()
+	for tag := range m.Tombstones {
+		next.Tombstones[tag] = true
+	}
+	for key, entry := range m.Entries {
+		next.Entries[key] = orEntry[V]{Value: entry.Value, Tags: copyTags(entry.Tags)}
+	}
+	return next
+}
+
+// Merge merges v into the item cached at key, caching v if the key does not exist.
+//
+// It returns the merged item, or an error if the merge is rejected, e.g. by the
+// cache's sink or a unique index.
+func Merge[T Mergeable[T]](c *Cache[T], key CacheKey, v T) (Item[T], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, _, err := c.merge(key, Item[T]{Data: &v}, sourceLocal)
+	if err != nil {
+		return Item[T]{}, err
+	}
+	return item, nil
+}
+
+// MergeAll merges every item into the cache, e.g. a snapshot taken from another instance.
+//
+// Items whose merge is rejected are skipped, and their errors are returned joined.
+func MergeAll[T Mergeable[T]](c *Cache[T], items map[CacheKey]Item[T]) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for key, item := range items {
+		if _, _, err := c.merge(key, item, sourceLocal); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// merge merges an item into the cache if T is Mergeable.
+//
+// It reports false if T is not Mergeable. Merges that do not change the cached
+// value are not committed, so replicas merging each other's changes converge.
+// The caller must hold c.mu.
+func (c *Cache[T]) merge(key CacheKey, item Item[T], src mutationSource) (Item[T], bool, error) {
+	if item.Data == nil {
+		return item, false, nil
+	}
+	if _, ok := any(*item.Data).(Mergeable[T]); !ok {
+		return item, false, nil
+	}
+	var err error
+	prev, ok := c.raw.caches[key]
+	switch {
+	case !ok && item.Version == 0:
+		item, err = c.insert(key, item.Data, src)
+	case !ok || prev.Data == nil:
+		err = c.put(key, item, src)
+	default:
+		merged := any(*prev.Data).(Mergeable[T]).Merge(*item.Data)
+		if reflect.DeepEqual(merged, *prev.Data) {
+			return *prev, true, nil
+		}
+		item, err = c.replace(key, prev, &merged, src)
+	}
+	return item, true, err
+}
+
+// crdtID identifies an element of a set by its json encoding.
+func crdtID(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", NewError[ORSet[any]](fmt.Sprintf("cannot encode element: %s", err.Error()))
+	}
+	return string(b), nil
+}
+
+func copyTags(tags map[string]bool) map[string]bool {
+	next := make(map[string]bool, len(tags))
+	for tag := range tags {
+		next[tag] = true
+	}
+	return next
+}
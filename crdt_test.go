@@ -0,0 +1,156 @@
+package mnemo
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGCounter(t *testing.T) {
+	a := NewGCounter().Increment("a", 2)
+	b := NewGCounter().Increment("b", 3)
+	if a.Merge(b).Value() != 5 || b.Merge(a).Value() != 5 {
+		t.Error("expected merged counters to sum increments from both nodes")
+	}
+	if a.Merge(a).Value() != 2 {
+		t.Error("expected merge to be idempotent")
+	}
+	if a.Value() != 2 {
+		t.Error("expected merge not to modify the receiver")
+	}
+}
+
+func TestPNCounter(t *testing.T) {
+	a := NewPNCounter().Increment("a", 5)
+	b := NewPNCounter().Decrement("b", 7)
+	if v := a.Merge(b).Value(); v != -2 {
+		t.Errorf("expected -2; got %d", v)
+	}
+}
+
+func TestHLC(t *testing.T) {
+	wall := time.Unix(100, 0)
+	c := NewHLC("a")
+	c.now = func() time.Time { return wall }
+	t1 := c.Now()
+	t2 := c.Now()
+	if !t1.Before(t2) {
+		t.Error("expected timestamps to advance when wall time does not")
+	}
+	remote := Timestamp{Wall: wall.Add(time.Second).UnixNano(), Logical: 4, Node: "b"}
+	t3 := c.Update(remote)
+	if !remote.Before(t3) {
+		t.Error("expected clock to advance past remote timestamp")
+	}
+}
+
+func TestLWWRegister(t *testing.T) {
+	ca, cb := NewHLC("a"), NewHLC("b")
+	a := NewLWWRegister("first", ca)
+	b := a.Set("second", cb)
+	if a.Merge(b).Value != "second" || b.Merge(a).Value != "second" {
+		t.Error("expected latest write to win regardless of merge order")
+	}
+}
+
+func TestORSet(t *testing.T) {
+	a, _ := NewORSet[string]().Add("x", "a")
+	b := a.Merge(NewORSet[string]())
+	// a removes x while b concurrently re-adds it
+	a, _ = a.Remove("x")
+	b, _ = b.Add("x", "b")
+	if !a.Merge(b).Contains("x") || !b.Merge(a).Contains("x") {
+		t.Error("expected concurrent add to win over remove")
+	}
+	c, _ := b.Merge(a).Remove("x")
+	if c.Merge(a).Merge(b).Contains("x") {
+		t.Error("expected observed adds to stay removed")
+	}
+
+	// elements that cannot be encoded are rejected rather than sharing an id
+	f, _ := NewORSet[any]().Add("x", "a")
+	if _, err := f.Add(func() {}, "a"); err == nil {
+		t.Error("expected error adding unencodable element")
+	}
+	if _, err := f.Remove(make(chan int)); err == nil {
+		t.Error("expected error removing unencodable element")
+	}
+	if len(f.Values()) != 1 || f.Contains(func() {}) {
+		t.Errorf("expected set to be unchanged; got %v", f.Values())
+	}
+}
+
+func TestORMap(t *testing.T) {
+	a := NewORMap[GCounter]().Put("hits", NewGCounter().Increment("a", 1), "a")
+	b := NewORMap[GCounter]().Put("hits", NewGCounter().Increment("b", 2), "b")
+	m := a.Merge(b)
+	v, ok := m.Get("hits")
+	if !ok || v.Value() != 3 {
+		t.Errorf("expected values under the same key to merge; got %v", v.Value())
+	}
+	if _, ok := m.Remove("hits").Get("hits"); ok {
+		t.Error("expected key to be removed")
+	}
+}
+
+func TestMergeCache(t *testing.T) {
+	c := newCache[GCounter]()
+	Merge(c, "hits", NewGCounter().Increment("a", 1))
+	item, err := Merge(c, "hits", NewGCounter().Increment("b", 2))
+	if err != nil || item.Data.Value() != 3 {
+		t.Errorf("expected 3; got %d, %v", item.Data.Value(), err)
+	}
+
+	// merges rejected by the sink are returned rather than only logged
+	sink := NewMemorySink[GCounter]()
+	c.SetSink(sink)
+	defer c.CloseSink()
+	sink.SetError(errors.New("unavailable"))
+	if _, err := Merge(c, "hits", NewGCounter().Increment("c", 4)); err == nil {
+		t.Error("expected sink error from Merge")
+	}
+	d, e := NewGCounter().Increment("d", 1), NewGCounter()
+	err = MergeAll(c, map[CacheKey]Item[GCounter]{"hits": {Data: &d}, "other": {Data: &e}})
+	if err == nil {
+		t.Error("expected sink error from MergeAll")
+	}
+	if item, _ := c.Get("hits"); item.Data.Value() != 3 {
+		t.Errorf("expected rejected merge not to be cached; got %d", item.Data.Value())
+	}
+}
+
+func TestCRDTReplication(t *testing.T) {
+	newReplica := func(name string, port int) (*Mnemo, *Cache[GCounter]) {
+		store := StoreKey("crdt_" + name)
+		m := New().WithServer("crdt_"+name, WithPort(port), WithSilence(), WithReplication())
+		NewStore(store)
+		m.WithStores(store)
+		c, err := NewCache[GCounter](store, "hits")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Server().ListenAndServe()
+		t.Cleanup(func() { m.Server().Shutdown() })
+		return m, c
+	}
+	a, ac := newReplica("a", 8208)
+	b, bc := newReplica("b", 8209)
+
+	fa := NewFollower(a, b.Server().URL(), WithReconnectInterval(20*time.Millisecond)).Follow("crdt_b", "crdt_a")
+	fb := NewFollower(b, a.Server().URL(), WithReconnectInterval(20*time.Millisecond)).Follow("crdt_a", "crdt_b")
+	fa.Start()
+	fb.Start()
+	defer fa.Stop()
+	defer fb.Stop()
+	waitFor(t, 2*time.Second, func() bool { return fa.Stats().Synced && fb.Stats().Synced })
+
+	for i := 0; i < 5; i++ {
+		Merge(ac, "hits", NewGCounter().Increment("a", uint64(i+1)))
+		Merge(bc, "hits", NewGCounter().Increment("b", uint64(i+1)))
+	}
+	waitFor(t, 2*time.Second, func() bool {
+		ai, aok := ac.Get("hits")
+		bi, bok := bc.Get("hits")
+		return aok && bok && ai.Data.Value() == 10 && bi.Data.Value() == 10
+	})
+}
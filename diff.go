@@ -0,0 +1,214 @@
+package mnemo
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// CacheDiff is the difference between two states of a cache.
+	CacheDiff[T any] struct {
+		From    time.Time        `json:"from"`
+		To      time.Time        `json:"to"`
+		Raw     KeyDiff[Item[T]] `json:"raw"`
+		Reduced KeyDiff[any]     `json:"reduced"`
+	}
+	// KeyDiff lists the keys added, removed and changed between two states, ordered by key.
+	KeyDiff[V any] struct {
+		Added   []DiffEntry[V] `json:"added"`
+		Removed []DiffEntry[V] `json:"removed"`
+		Changed []DiffEntry[V] `json:"changed"`
+	}
+	// DiffEntry is the change to a single key. From is empty for added keys and
+	// To is empty for removed keys.
+	DiffEntry[V any] struct {
+		Key  CacheKey `json:"key"`
+		From V        `json:"from"`
+		To   V        `json:"to"`
+		// Patch is a JSON Patch (RFC 6902) from the old data to the new data of
+		// a changed key. It is empty if the data cannot be serialized to json.
+		Patch []PatchOp `json:"patch,omitempty"`
+	}
+	// PatchOp is a single JSON Patch operation.
+	PatchOp struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}
+)
+
+// MarshalJSON implements the json.Marshaler interface, omitting the value of remove operations.
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	type patchOp PatchOp
+	return json.Marshal(patchOp(op))
+}
+
+// Diff returns the difference between the state of the cache at from and at to.
+//
+// A time before history began is treated as an empty cache.
+func (c *Cache[T]) Diff(from, to time.Time) CacheDiff[T] {
+	a, _ := c.At(from)
+	b, _ := c.At(to)
+	d := diffSnapshots(a, b)
+	d.From, d.To = from, to
+	return d
+}
+
+// DiffFeed returns a channel of the differences between consecutive history entries.
+//
+// The feed is created on the first call. Diffs are dropped if it is full.
+func (c *Cache[T]) DiffFeed() chan CacheDiff[T] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.diffs == nil {
+		c.diffs = make(chan CacheDiff[T], 1024)
+	}
+	return c.diffs
+}
+
+// publishDiff sends the difference between two history entries to the diff feed, if there is one.
+func (c *Cache[T]) publishDiff(prev, next Snapshot[T]) {
+	c.mu.Lock()
+	feed := c.diffs
+	c.mu.Unlock()
+	if feed == nil {
+		return
+	}
+	d := diffSnapshots(prev, next)
+	select {
+	case feed <- d:
+	default:
+		c.metrics.diffDropped.Add(1)
+		NewError[Cache[T]]("diff feed is full, dropping diff").WithLogLevel(Warn).Log()
+	}
+}
+
+// diffSnapshots returns the difference between two snapshots.
+func diffSnapshots[T any](a, b Snapshot[T]) CacheDiff[T] {
+	d := CacheDiff[T]{From: a.CreatedAt, To: b.CreatedAt}
+	d.Raw = diffKeys(a.Raw, b.Raw, func(i Item[T]) any { return i.Data })
+
+	ra := make(map[CacheKey]any, len(a.Reduced))
+	for _, r := range a.Reduced {
+		ra[r.Key] = r.Data
+	}
+	rb := make(map[CacheKey]any, len(b.Reduced))
+	for _, r := range b.Reduced {
+		rb[r.Key] = r.Data
+	}
+	d.Reduced = diffKeys(ra, rb, func(v any) any { return v })
+	return d
+}
+
+// diffKeys compares two states by key, patching the data returned by data for changed keys.
+func diffKeys[V any](a, b map[CacheKey]V, data func(V) any) KeyDiff[V] {
+	d := KeyDiff[V]{Added: []DiffEntry[V]{}, Removed: []DiffEntry[V]{}, Changed: []DiffEntry[V]{}}
+	for key, from := range a {
+		to, ok := b[key]
+		switch {
+		case !ok:
+			d.Removed = append(d.Removed, DiffEntry[V]{Key: key, From: from})
+		case !reflect.DeepEqual(from, to):
+			patch, _ := JSONPatch(data(from), data(to))
+			d.Changed = append(d.Changed, DiffEntry[V]{Key: key, From: from, To: to, Patch: patch})
+		}
+	}
+	for key, to := range b {
+		if _, ok := a[key]; !ok {
+			d.Added = append(d.Added, DiffEntry[V]{Key: key, To: to})
+		}
+	}
+	for _, entries := range [][]DiffEntry[V]{d.Added, d.Removed, d.Changed} {
+		sort.Slice(entries, func(i, j int) bool {
+			return fmt.Sprint(entries[i].Key) < fmt.Sprint(entries[j].Key)
+		})
+	}
+	return d
+}
+
+// JSONPatch returns the JSON Patch (RFC 6902) operations that transform the
+// json representation of from into that of to.
+func JSONPatch(from, to any) ([]PatchOp, error) {
+	a, err := toJSONValue(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toJSONValue(to)
+	if err != nil {
+		return nil, err
+	}
+	return diffJSON("", a, b, []PatchOp{}), nil
+}
+
+// toJSONValue converts v to the form encoding/json decodes it to.
+func toJSONValue(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
+
+func diffJSON(path string, a, b any, ops []PatchOp) []PatchOp {
+	if reflect.DeepEqual(a, b) {
+		return ops
+	}
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(a)+len(b))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		for k := range b {
+			if _, ok := a[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := path + "/" + escapePointer(k)
+			av, inA := a[k]
+			bv, inB := b[k]
+			switch {
+			case !inB:
+				ops = append(ops, PatchOp{Op: "remove", Path: p})
+			case !inA:
+				ops = append(ops, PatchOp{Op: "add", Path: p, Value: bv})
+			default:
+				ops = diffJSON(p, av, bv, ops)
+			}
+		}
+		return ops
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			break
+		}
+		for i := range a {
+			ops = diffJSON(fmt.Sprintf("%s/%d", path, i), a[i], b[i], ops)
+		}
+		return ops
+	}
+	return append(ops, PatchOp{Op: "replace", Path: path, Value: b})
+}
+
+// escapePointer escapes a key for use in a JSON Pointer.
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
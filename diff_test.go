@@ -0,0 +1,111 @@
+package mnemo
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONPatch(t *testing.T) {
+	type doc struct {
+		Name string            `json:"name"`
+		Tags []string          `json:"tags"`
+		Meta map[string]string `json:"meta,omitempty"`
+	}
+	from := doc{Name: "ann", Tags: []string{"a", "b"}, Meta: map[string]string{"a/b": "x", "old": "y"}}
+	to := doc{Name: "bob", Tags: []string{"a", "c"}, Meta: map[string]string{"a/b": "x", "new": "z"}}
+	ops, err := JSONPatch(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PatchOp{
+		{Op: "add", Path: "/meta/new", Value: "z"},
+		{Op: "remove", Path: "/meta/old"},
+		{Op: "replace", Path: "/name", Value: "bob"},
+		{Op: "replace", Path: "/tags/1", Value: "c"},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("unexpected patch\n got: %v\nwant: %v", ops, want)
+	}
+
+	b, _ := json.Marshal(ops[1])
+	if string(b) != `{"op":"remove","path":"/meta/old"}` {
+		t.Errorf("expected remove op without value; got %s", b)
+	}
+	if ops, _ := JSONPatch(1, 2); len(ops) != 1 || ops[0].Path != "" {
+		t.Errorf("expected root replace; got %v", ops)
+	}
+	if _, err := JSONPatch(func() {}, 1); err == nil {
+		t.Error("expected error for data that cannot be serialized")
+	}
+}
+
+func TestCacheDiff(t *testing.T) {
+	cache := newCache[int]()
+	cache.SetReducer(cache.DefaultReducer)
+	<-cache.ReducerFeed()
+	// recorded waits until the latest history entry holds n items
+	recorded := func(n int, key CacheKey) time.Time {
+		waitFor(t, time.Second, func() bool {
+			snap, _ := cache.At(time.Now())
+			_, ok := snap.Raw[key]
+			return len(snap.Raw) == n && ok && len(snap.Reduced) == n
+		})
+		return time.Now()
+	}
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Set("c", 3)
+	times := []time.Time{recorded(3, "c")}
+	cache.Set("a", 10)
+	cache.Delete("b")
+	cache.Set("d", 4)
+	times = append(times, recorded(3, "d"))
+
+	d := cache.Diff(times[0], times[1])
+	if len(d.Raw.Added) != 1 || d.Raw.Added[0].Key != "d" {
+		t.Errorf("unexpected added keys %+v", d.Raw.Added)
+	}
+	if len(d.Raw.Removed) != 1 || d.Raw.Removed[0].Key != "b" {
+		t.Errorf("unexpected removed keys %+v", d.Raw.Removed)
+	}
+	if len(d.Raw.Changed) != 1 || d.Raw.Changed[0].Key != "a" {
+		t.Fatalf("unexpected changed keys %+v", d.Raw.Changed)
+	}
+	want := []PatchOp{{Op: "replace", Path: "", Value: float64(10)}}
+	if !reflect.DeepEqual(d.Raw.Changed[0].Patch, want) {
+		t.Errorf("unexpected patch %v", d.Raw.Changed[0].Patch)
+	}
+	if len(d.Reduced.Added) != 1 || len(d.Reduced.Removed) != 1 || len(d.Reduced.Changed) != 1 {
+		t.Errorf("unexpected reduced diff %+v", d.Reduced)
+	}
+
+	if d := cache.Diff(time.Time{}, times[0]); len(d.Raw.Added) != 3 {
+		t.Errorf("expected diff from empty cache; got %+v", d.Raw)
+	}
+}
+
+func TestDiffFeed(t *testing.T) {
+	cache := newCache[int]()
+	diffs := cache.DiffFeed()
+	cache.SetReducer(cache.DefaultReducer)
+	cache.Set("a", 1)
+	select {
+	case d := <-diffs:
+		if len(d.Raw.Added) != 1 || d.Raw.Added[0].Key != "a" || !d.From.Before(d.To) {
+			t.Errorf("unexpected diff %+v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected diff")
+	}
+	cache.Set("a", 2)
+	select {
+	case d := <-diffs:
+		if len(d.Raw.Changed) != 1 || len(d.Raw.Changed[0].Patch) != 1 {
+			t.Errorf("unexpected diff %+v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected diff")
+	}
+}
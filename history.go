@@ -0,0 +1,87 @@
+package mnemo
+
+import (
+	"sort"
+	"time"
+)
+
+type (
+	// Snapshot is the state of a cache recorded in its history.
+	Snapshot[T any] struct {
+		CreatedAt time.Time `json:"created_at"`
+		// Seq is the sequence number of the last mutation included in the snapshot.
+		Seq     uint64               `json:"seq"`
+		Raw     map[CacheKey]Item[T] `json:"raw"`
+		Reduced []reducerCache[any]  `json:"reduced"`
+	}
+	// historyEntry orders history entries by time.
+	historyEntry struct {
+		at  time.Time
+		seq uint64
+	}
+)
+
+// At returns the state of the cache at t, which is the latest history entry
+// recorded at or before t. It returns false if no entry was recorded by then.
+//
+// History is only recorded once a reducer has been set.
+func (c *Cache[T]) At(t time.Time) (Snapshot[T], bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entryAt(t)
+	if !ok {
+		return Snapshot[T]{}, false
+	}
+	return c.snapshot(e), true
+}
+
+// entryAt returns the latest history entry recorded at or before t.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) entryAt(t time.Time) (historyEntry, bool) {
+	// first entry after t
+	i := sort.Search(len(c.raw.index), func(i int) bool {
+		return c.raw.index[i].at.After(t)
+	})
+	if i == 0 {
+		return historyEntry{}, false
+	}
+	return c.raw.index[i-1], true
+}
+
+// Between returns the history entries recorded from start to end inclusive, oldest first.
+func (c *Cache[T]) Between(start, end time.Time) []Snapshot[T] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	from, to := c.historyRange(start, end)
+	snapshots := make([]Snapshot[T], 0, to-from)
+	for _, e := range c.raw.index[from:to] {
+		snapshots = append(snapshots, c.snapshot(e))
+	}
+	return snapshots
+}
+
+// historyRange returns the bounds of the index entries recorded from start to end inclusive.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) historyRange(start, end time.Time) (int, int) {
+	from := sort.Search(len(c.raw.index), func(i int) bool {
+		return !c.raw.index[i].at.Before(start)
+	})
+	to := sort.Search(len(c.raw.index), func(i int) bool {
+		return c.raw.index[i].at.After(end)
+	})
+	return from, max(from, to)
+}
+
+// snapshot returns the history entry recorded at e.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) snapshot(e historyEntry) Snapshot[T] {
+	return Snapshot[T]{
+		CreatedAt: e.at,
+		Seq:       e.seq,
+		Raw:       c.raw.history[e.at],
+		Reduced:   c.reducer.history[e.at],
+	}
+}
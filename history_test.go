@@ -0,0 +1,77 @@
+package mnemo
+
+import (
+	"testing"
+	"time"
+)
+
+// recordHistory caches each value under key and waits for each history entry,
+// returning the time after each write was recorded.
+func recordHistory(t *testing.T, cache *Cache[int], key CacheKey, values ...int) []time.Time {
+	t.Helper()
+	feed := cache.ReducerFeed()
+	times := make([]time.Time, 0, len(values))
+	for _, v := range values {
+		cache.Set(key, v)
+		select {
+		case <-feed:
+		case <-time.After(time.Second):
+			t.Fatal("expected history entry")
+		}
+		times = append(times, time.Now())
+	}
+	return times
+}
+
+func TestCacheAt(t *testing.T) {
+	cache := newCache[int]()
+	before := time.Now()
+	cache.SetReducer(cache.DefaultReducer)
+	<-cache.ReducerFeed()
+	times := recordHistory(t, cache, "key", 1, 2, 3)
+
+	if _, ok := cache.At(before.Add(-time.Second)); ok {
+		t.Error("expected no state before history began")
+	}
+	snap, ok := cache.At(times[1])
+	if !ok {
+		t.Fatal("expected state at time")
+	}
+	if *snap.Raw["key"].Data != 2 {
+		t.Errorf("expected raw state at time; got %d", *snap.Raw["key"].Data)
+	}
+	if len(snap.Reduced) != 1 || snap.Reduced[0].Data != 2 {
+		t.Errorf("expected reduced state at time; got %v", snap.Reduced)
+	}
+	if latest, _ := cache.At(time.Now()); *latest.Raw["key"].Data != 3 {
+		t.Error("expected latest state")
+	}
+}
+
+func TestCacheBetween(t *testing.T) {
+	cache := newCache[int]()
+	cache.SetReducer(cache.DefaultReducer)
+	<-cache.ReducerFeed()
+	times := recordHistory(t, cache, "key", 1, 2, 3, 4)
+
+	snaps := cache.Between(times[0], times[2])
+	if len(snaps) != 2 {
+		t.Fatalf("expected two entries in range; got %d", len(snaps))
+	}
+	if *snaps[0].Raw["key"].Data != 2 || *snaps[1].Raw["key"].Data != 3 {
+		t.Error("expected entries in order")
+	}
+	if !snaps[0].CreatedAt.Before(snaps[1].CreatedAt) || snaps[0].Seq >= snaps[1].Seq {
+		t.Error("expected entries to be ordered by time and sequence")
+	}
+	if len(cache.Between(times[3], times[0])) != 0 {
+		t.Error("expected empty range")
+	}
+
+	history := cache.ReducerHistory()
+	for i := 1; i < len(history); i++ {
+		if history[i].CreatedAt.Before(history[i-1].CreatedAt) {
+			t.Fatal("expected reducer history to be ordered")
+		}
+	}
+}
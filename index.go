@@ -0,0 +1,270 @@
+package mnemo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+type (
+	// IndexFunc extracts the value an item is indexed by.
+	//
+	// Items for which it returns nil are not indexed. Values must be comparable.
+	IndexFunc[T any] func(data T) any
+	// IndexConfig configures a secondary index.
+	IndexConfig struct {
+		// Unique rejects writes that would index two items by the same value.
+		Unique bool
+		// Multi indexes an item by every element of the slice or array returned
+		// by the index's function.
+		Multi bool
+	}
+	// index maps values extracted from items to the keys of those items.
+	index[T any] struct {
+		fn      IndexFunc[T]
+		cfg     IndexConfig
+		entries map[any]map[CacheKey]struct{}
+		values  map[CacheKey][]any
+	}
+)
+
+// WithUniqueIndex rejects writes that would index two items by the same value.
+func WithUniqueIndex() Opt[IndexConfig] {
+	return func(c *IndexConfig) {
+		c.Unique = true
+	}
+}
+
+// WithMultiValued indexes an item by every element of the slice returned by the index's function.
+func WithMultiValued() Opt[IndexConfig] {
+	return func(c *IndexConfig) {
+		c.Multi = true
+	}
+}
+
+// AddIndex adds a secondary index to the cache, built from the items already
+// cached and maintained on every write.
+//
+// It returns an error if an index with the same name exists or, for a unique
+// index, if two cached items share a value. Writes that would break a unique
+// index fail with an error.
+func (c *Cache[T]) AddIndex(name string, fn IndexFunc[T], opts ...Opt[IndexConfig]) error {
+	idx := &index[T]{
+		fn:      fn,
+		entries: make(map[any]map[CacheKey]struct{}),
+		values:  make(map[CacheKey][]any),
+	}
+	for _, o := range opts {
+		o(&idx.cfg)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.indexes[name]; ok {
+		return NewError[Cache[T]](fmt.Sprintf("index '%s' already exists", name))
+	}
+	for key, item := range c.raw.caches {
+		if err := idx.check(name, key, item.Data); err != nil {
+			return err
+		}
+		idx.add(key, item.Data)
+	}
+	if c.indexes == nil {
+		c.indexes = make(map[string]*index[T])
+	}
+	c.indexes[name] = idx
+	return nil
+}
+
+// RemoveIndex removes a secondary index from the cache.
+func (c *Cache[T]) RemoveIndex(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.indexes, name)
+}
+
+// Lookup returns the items indexed by value in the named index.
+func (c *Cache[T]) Lookup(name string, value any) (map[CacheKey]Item[T], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys, err := c.lookupKeys(name, value)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[CacheKey]Item[T], len(keys))
+	for _, key := range keys {
+		items[key] = *c.raw.caches[key]
+	}
+	return items, nil
+}
+
+// LookupOne returns the item indexed by value in the named index, which is
+// usually unique. If several items match, the oldest is returned.
+func (c *Cache[T]) LookupOne(name string, value any) (Item[T], bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys, err := c.lookupKeys(name, value)
+	if err != nil || len(keys) == 0 {
+		return *new(Item[T]), false, err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := c.raw.caches[keys[i]], c.raw.caches[keys[j]]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return *c.raw.caches[keys[0]], true, nil
+}
+
+// lookupKeys returns the keys of the items indexed by value in the named index.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) lookupKeys(name string, value any) ([]CacheKey, error) {
+	idx, ok := c.indexes[name]
+	if !ok {
+		return nil, NewError[Cache[T]](fmt.Sprintf("no index '%s'", name))
+	}
+	if value == nil || !reflect.TypeOf(value).Comparable() {
+		return nil, NewError[Cache[T]](fmt.Sprintf("value '%v' cannot be looked up", value))
+	}
+	keys := make([]CacheKey, 0, len(idx.entries[value]))
+	for key := range idx.entries[value] {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// checkIndexes returns an error if caching data by key would break a unique index.
+// Transactions check their writes as a batch beforehand.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) checkIndexes(key CacheKey, data *T, src mutationSource) error {
+	if src == sourceSynced {
+		return nil
+	}
+	for name, idx := range c.indexes {
+		if err := idx.check(name, key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkIndexBatch returns an error if applying writes to keys at once would
+// break a unique index. A nil write deletes its key.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) checkIndexBatch(keys []CacheKey, writes []*T) error {
+	batch := make(map[CacheKey]bool, len(keys))
+	for _, key := range keys {
+		batch[key] = true
+	}
+	for name, idx := range c.indexes {
+		if !idx.cfg.Unique {
+			continue
+		}
+		seen := make(map[any]CacheKey)
+		for i, key := range keys {
+			for _, v := range idx.extract(writes[i]) {
+				if other, ok := seen[v]; ok && other != key {
+					return idx.conflict(name, v)
+				}
+				seen[v] = key
+				for other := range idx.entries[v] {
+					if !batch[other] {
+						return idx.conflict(name, v)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// updateIndexes applies a committed mutation to every index.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) updateIndexes(op mutationOp, key CacheKey, item Item[T]) {
+	for _, idx := range c.indexes {
+		idx.remove(key)
+		if op != opDelete {
+			idx.add(key, item.Data)
+		}
+	}
+}
+
+// extract returns the distinct values data is indexed by.
+func (idx *index[T]) extract(data *T) []any {
+	if data == nil {
+		return nil
+	}
+	v := idx.fn(*data)
+	if v == nil {
+		return nil
+	}
+	if !idx.cfg.Multi {
+		if !reflect.TypeOf(v).Comparable() {
+			return nil
+		}
+		return []any{v}
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	values := make([]any, 0, rv.Len())
+	seen := make(map[any]bool, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		e := rv.Index(i).Interface()
+		if e == nil || !reflect.TypeOf(e).Comparable() || seen[e] {
+			continue
+		}
+		seen[e] = true
+		values = append(values, e)
+	}
+	return values
+}
+
+// check returns an error if indexing data by key would break a unique index.
+func (idx *index[T]) check(name string, key CacheKey, data *T) error {
+	if !idx.cfg.Unique {
+		return nil
+	}
+	for _, v := range idx.extract(data) {
+		for other := range idx.entries[v] {
+			if other != key {
+				return idx.conflict(name, v)
+			}
+		}
+	}
+	return nil
+}
+
+func (idx *index[T]) conflict(name string, value any) error {
+	return NewError[Cache[T]](fmt.Sprintf("unique index '%s' already has value '%v'", name, value))
+}
+
+func (idx *index[T]) add(key CacheKey, data *T) {
+	values := idx.extract(data)
+	if len(values) == 0 {
+		return
+	}
+	for _, v := range values {
+		if idx.entries[v] == nil {
+			idx.entries[v] = make(map[CacheKey]struct{})
+		}
+		idx.entries[v][key] = struct{}{}
+	}
+	idx.values[key] = values
+}
+
+func (idx *index[T]) remove(key CacheKey) {
+	for _, v := range idx.values[key] {
+		delete(idx.entries[v], key)
+		if len(idx.entries[v]) == 0 {
+			delete(idx.entries, v)
+		}
+	}
+	delete(idx.values, key)
+}
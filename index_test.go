@@ -0,0 +1,133 @@
+package mnemo
+
+import (
+	"testing"
+)
+
+type indexedUser struct {
+	Name  string
+	Email string
+	Tags  []string
+}
+
+func TestIndexLookup(t *testing.T) {
+	cache := newCache[indexedUser]()
+	cache.Set(1, indexedUser{Name: "ann", Email: "ann@example.com"})
+	cache.Set(2, indexedUser{Name: "bob", Email: "bob@example.com"})
+	cache.Set(3, indexedUser{Name: "ann", Email: "ann2@example.com"})
+
+	if err := cache.AddIndex("byName", func(u indexedUser) any { return u.Name }); err != nil {
+		t.Fatal(err)
+	}
+	items, err := cache.Lookup("byName", "ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Errorf("expected existing items to be indexed; got %d", len(items))
+	}
+
+	cache.Update(3, indexedUser{Name: "cat"})
+	cache.Delete(2)
+	if items, _ := cache.Lookup("byName", "ann"); len(items) != 1 {
+		t.Errorf("expected updated item to be reindexed; got %d", len(items))
+	}
+	if items, _ := cache.Lookup("byName", "bob"); len(items) != 0 {
+		t.Error("expected deleted item to be removed from index")
+	}
+	if item, ok, _ := cache.LookupOne("byName", "cat"); !ok || item.Data.Name != "cat" {
+		t.Error("expected to look up updated item")
+	}
+	if _, err := cache.Lookup("missing", "ann"); err == nil {
+		t.Error("expected error for missing index")
+	}
+	if err := cache.AddIndex("byName", func(u indexedUser) any { return u.Name }); err == nil {
+		t.Error("expected error for duplicate index")
+	}
+}
+
+func TestUniqueIndex(t *testing.T) {
+	cache := newCache[indexedUser]()
+	err := cache.AddIndex("byEmail", func(u indexedUser) any { return u.Email }, WithUniqueIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ann := indexedUser{Name: "ann", Email: "ann@example.com"}
+	if err := cache.Cache(1, &ann); err != nil {
+		t.Fatal(err)
+	}
+	dup := indexedUser{Name: "imposter", Email: "ann@example.com"}
+	if err := cache.Cache(2, &dup); err == nil {
+		t.Error("expected unique index to reject duplicate value")
+	}
+	if _, ok := cache.Get(2); ok {
+		t.Error("expected rejected item not to be cached")
+	}
+	if !cache.Update(1, indexedUser{Name: "ann", Email: "ann@example.com"}) {
+		t.Error("expected item to keep its own unique value")
+	}
+
+	bob := indexedUser{Name: "bob", Email: "bob@example.com"}
+	cache.Cache(2, &bob)
+	results := cache.UpdateMany(map[CacheKey]indexedUser{2: {Email: "ann@example.com"}})
+	if results[2] != BatchFailed {
+		t.Errorf("expected batch write to fail; got %v", results[2])
+	}
+
+	other := newCache[indexedUser]()
+	other.Cache(1, &ann)
+	other.Cache(2, &dup)
+	if err := other.AddIndex("byEmail", func(u indexedUser) any { return u.Email }, WithUniqueIndex()); err == nil {
+		t.Error("expected unique index not to be built over duplicate values")
+	}
+}
+
+func TestMultiValuedIndex(t *testing.T) {
+	cache := newCache[indexedUser]()
+	cache.AddIndex("byTag", func(u indexedUser) any { return u.Tags }, WithMultiValued())
+	cache.Set(1, indexedUser{Name: "ann", Tags: []string{"admin", "dev", "dev"}})
+	cache.Set(2, indexedUser{Name: "bob", Tags: []string{"dev"}})
+	cache.Set(3, indexedUser{Name: "cat"})
+
+	if items, _ := cache.Lookup("byTag", "dev"); len(items) != 2 {
+		t.Errorf("expected two items tagged dev; got %d", len(items))
+	}
+	if items, _ := cache.Lookup("byTag", "admin"); len(items) != 1 {
+		t.Errorf("expected one item tagged admin; got %d", len(items))
+	}
+	cache.Update(1, indexedUser{Name: "ann", Tags: []string{"admin"}})
+	if items, _ := cache.Lookup("byTag", "dev"); len(items) != 1 {
+		t.Errorf("expected removed tag to be unindexed; got %d", len(items))
+	}
+}
+
+func TestUniqueIndexTransaction(t *testing.T) {
+	var key StoreKey = "index_tx_store"
+	store, _ := NewStore(key)
+	cache, _ := NewCache[indexedUser](key, "users")
+	cache.AddIndex("byEmail", func(u indexedUser) any { return u.Email }, WithUniqueIndex())
+	cache.Set(1, indexedUser{Email: "a@example.com"})
+	cache.Set(2, indexedUser{Email: "b@example.com"})
+
+	// swapping unique values is valid as a whole
+	err := store.Transaction(func(tx *Tx) error {
+		TxSet(tx, "users", 1, indexedUser{Email: "b@example.com"})
+		return TxSet(tx, "users", 2, indexedUser{Email: "a@example.com"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item, _, _ := cache.LookupOne("byEmail", "a@example.com"); item.Data == nil || item.Data.Email != "a@example.com" {
+		t.Error("expected swapped values to be indexed")
+	}
+	if items, _ := cache.Lookup("byEmail", "a@example.com"); len(items) != 1 {
+		t.Errorf("expected a single item per unique value; got %d", len(items))
+	}
+
+	err = store.Transaction(func(tx *Tx) error {
+		return TxSet(tx, "users", 3, indexedUser{Email: "a@example.com"})
+	})
+	if err == nil {
+		t.Error("expected transaction to be rejected by unique index")
+	}
+}
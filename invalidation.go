@@ -0,0 +1,249 @@
+package mnemo
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type (
+	// InvalidationBus broadcasts invalidations of cache keys between Mnemo instances.
+	//
+	// Caches are watched under a topic. When a key in a watched cache is updated
+	// or deleted, every peer drops its copy of the key from the caches it watches
+	// under the same topic.
+	InvalidationBus struct {
+		mu     sync.Mutex
+		topics map[string][]invalidatable
+		peers  map[string]*peer
+		cfg    invalidationConfig
+	}
+	invalidationConfig struct {
+		Buffer    int
+		Reconnect time.Duration
+		Header    http.Header
+	}
+	// invalidatable is implemented by every Cache so caches of any type can
+	// be watched by an InvalidationBus.
+	invalidatable interface {
+		watchInvalidations(fn func(key wireKey)) (cancel func())
+		invalidate(key wireKey) error
+	}
+	// invalidationMessage is sent between peers when a key is invalidated.
+	invalidationMessage struct {
+		Topic string  `json:"topic"`
+		Key   wireKey `json:"key"`
+	}
+)
+
+// WithInvalidationBuffer sets the number of invalidations queued per peer.
+func WithInvalidationBuffer(size int) Opt[InvalidationBus] {
+	return func(b *InvalidationBus) {
+		b.cfg.Buffer = size
+	}
+}
+
+// WithPeerReconnectInterval sets how long the bus waits before reconnecting to a peer.
+func WithPeerReconnectInterval(d time.Duration) Opt[InvalidationBus] {
+	return func(b *InvalidationBus) {
+		b.cfg.Reconnect = d
+	}
+}
+
+// WithPeerHeader sets the header sent when connecting to peers, such as the
+// credentials required by their servers' authenticators.
+func WithPeerHeader(header http.Header) Opt[InvalidationBus] {
+	return func(b *InvalidationBus) {
+		b.cfg.Header = header
+	}
+}
+
+// NewInvalidationBus creates a new invalidation bus with no peers.
+func NewInvalidationBus(opts ...Opt[InvalidationBus]) *InvalidationBus {
+	b := &InvalidationBus{
+		topics: make(map[string][]invalidatable),
+		peers:  make(map[string]*peer),
+		cfg: invalidationConfig{
+			Buffer:    1024,
+			Reconnect: time.Second,
+		},
+	}
+	for _, o := range opts {
+		o(b)
+	}
+	return b
+}
+
+// WithPeers adds peers to the Mnemo instance's invalidation bus.
+//
+// Peers are the base websocket urls of other Mnemo instances' servers, which
+// must be created WithInvalidation.
+func (m *Mnemo) WithPeers(urls ...string) *Mnemo {
+	b := m.Invalidation()
+	for _, u := range urls {
+		b.AddPeer(u)
+	}
+	return m
+}
+
+// Invalidation returns the Mnemo instance's invalidation bus.
+func (m *Mnemo) Invalidation() *InvalidationBus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.invalidation == nil {
+		m.invalidation = NewInvalidationBus()
+	}
+	return m.invalidation
+}
+
+// AddPeer connects the bus to a peer. Adding an existing peer has no effect.
+func (b *InvalidationBus) AddPeer(url string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.peers[url]; ok {
+		return
+	}
+	b.peers[url] = newPeer(url+"/invalidate", b.cfg.Header, b.cfg.Buffer, b.cfg.Reconnect)
+}
+
+// RemovePeer disconnects the bus from a peer.
+func (b *InvalidationBus) RemovePeer(url string) {
+	b.mu.Lock()
+	p, ok := b.peers[url]
+	delete(b.peers, url)
+	b.mu.Unlock()
+	if ok {
+		p.close()
+	}
+}
+
+// Peers returns the bus's peers and whether each is currently connected.
+func (b *InvalidationBus) Peers() map[string]bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	peers := make(map[string]bool, len(b.peers))
+	for u, p := range b.peers {
+		peers[u] = p.isConnected()
+	}
+	return peers
+}
+
+// Close disconnects the bus from all peers.
+func (b *InvalidationBus) Close() {
+	b.mu.Lock()
+	peers := b.peers
+	b.peers = make(map[string]*peer)
+	b.mu.Unlock()
+	for _, p := range peers {
+		p.close()
+	}
+}
+
+// Watch broadcasts updates and deletes of the cache's keys to peers under topic,
+// and deletes keys from the cache when peers invalidate them under topic.
+//
+// The returned function stops watching the cache.
+func (b *InvalidationBus) Watch(topic string, c invalidatable) (cancel func()) {
+	b.mu.Lock()
+	b.topics[topic] = append(b.topics[topic], c)
+	b.mu.Unlock()
+
+	stop := c.watchInvalidations(func(key wireKey) {
+		b.broadcast(invalidationMessage{Topic: topic, Key: key})
+	})
+	return func() {
+		stop()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		watched := b.topics[topic]
+		for i, w := range watched {
+			if w == c {
+				b.topics[topic] = append(watched[:i], watched[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// broadcast sends an invalidation to every peer.
+func (b *InvalidationBus) broadcast(msg invalidationMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for u, p := range b.peers {
+		if !p.send(msg) {
+			NewError[InvalidationBus](
+				fmt.Sprintf("dropped invalidation for peer '%s'", u),
+			).WithLogLevel(Warn).Log()
+		}
+	}
+}
+
+// receive deletes an invalidated key from every cache watched under the message's topic.
+func (b *InvalidationBus) receive(msg invalidationMessage) {
+	b.mu.Lock()
+	watched := append([]invalidatable{}, b.topics[msg.Topic]...)
+	b.mu.Unlock()
+	for _, c := range watched {
+		if err := c.invalidate(msg.Key); err != nil {
+			NewError[InvalidationBus](err.Error()).Log()
+		}
+	}
+}
+
+// HandleInvalidate upgrades the http connection to a websocket connection
+// and applies invalidations sent by a peer to the Mnemo instance's invalidation bus.
+//
+// The route is only served by servers created WithInvalidation.
+func (s *Server) HandleInvalidate(w http.ResponseWriter, r *http.Request) {
+	if s.mnemo == nil {
+		http.Error(w, "server has no mnemo instance", http.StatusServiceUnavailable)
+		return
+	}
+	bus := s.mnemo.Invalidation()
+
+	upgrader := websocket.Upgrader{}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		NewError[Server](err.Error()).Log()
+		return
+	}
+	defer ws.Close()
+
+	for {
+		var msg invalidationMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		bus.receive(msg)
+	}
+}
+
+// watchInvalidations calls fn with the key of every local update or delete.
+func (c *Cache[T]) watchInvalidations(fn func(key wireKey)) (cancel func()) {
+	return c.listen(func(m mutation[T]) {
+		if m.Source != sourceLocal || m.Op == opCache {
+			return
+		}
+		wk, err := encodeKey(m.Key)
+		if err != nil {
+			NewError[Cache[T]](err.Error()).Log()
+			return
+		}
+		fn(wk)
+	})
+}
+
+// invalidate deletes a key invalidated by a peer, if present.
+func (c *Cache[T]) invalidate(key wireKey) error {
+	k, err := decodeKey(key)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.remove(k, sourceRemote)
+	return err
+}
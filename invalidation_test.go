@@ -0,0 +1,68 @@
+package mnemo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInvalidationBus(t *testing.T) {
+	newPeerCache := func(name string, port int) (*Mnemo, *Cache[string]) {
+		store := StoreKey("invalidation_" + name)
+		m := New().WithServer("invalidation_"+name, WithPort(port), WithSilence(), WithInvalidation())
+		NewStore(store)
+		m.WithStores(store)
+		c, err := NewCache[string](store, "users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Server().ListenAndServe()
+		return m, c
+	}
+	a, ac := newPeerCache("a", 8203)
+	b, bc := newPeerCache("b", 8204)
+	defer a.Server().Shutdown()
+	defer b.Server().Shutdown()
+
+	a.WithPeers(b.Server().URL())
+	b.WithPeers(a.Server().URL())
+	defer a.Invalidation().Close()
+	defer b.Invalidation().Close()
+	a.Invalidation().Watch("users", ac)
+	b.Invalidation().Watch("users", bc)
+
+	waitFor(t, 2*time.Second, func() bool {
+		return a.Invalidation().Peers()[b.Server().URL()] && b.Invalidation().Peers()[a.Server().URL()]
+	})
+
+	alice, bob := "alice", "bob"
+	ac.Cache(1, &alice)
+	bc.Cache(1, &alice)
+	ac.Cache(2, &bob)
+	bc.Cache(2, &bob)
+
+	ac.Update(1, "alicia")
+	waitFor(t, 2*time.Second, func() bool {
+		_, ok := bc.Get(1)
+		return !ok
+	})
+	if item, ok := ac.Get(1); !ok || *item.Data != "alicia" {
+		t.Error("expected local update to be kept")
+	}
+
+	bc.Delete(2)
+	waitFor(t, 2*time.Second, func() bool {
+		_, ok := ac.Get(2)
+		return !ok
+	})
+}
+
+func TestInvalidationOptIn(t *testing.T) {
+	m := New().WithServer("invalidation_disabled", WithPort(8222), WithSilence())
+	rec := httptest.NewRecorder()
+	m.Server().http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/invalidation_disabled/invalidate", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected invalidate route not to be served without WithInvalidation; got %d", rec.Code)
+	}
+}
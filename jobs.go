@@ -0,0 +1,396 @@
+package mnemo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+type (
+	// JobID is a unique identifier for a submitted command.
+	JobID string
+	// JobStatus is the state of a job.
+	JobStatus string
+	// Job is the state of a command submitted to run in the background.
+	Job struct {
+		ID      JobID      `json:"id"`
+		Command CommandKey `json:"command"`
+		Args    any        `json:"args,omitempty"`
+		Status  JobStatus  `json:"status"`
+		// Progress is the fraction of the job completed, as reported by its command.
+		Progress    float64   `json:"progress"`
+		Message     string    `json:"message,omitempty"`
+		Result      any       `json:"result,omitempty"`
+		Error       string    `json:"error,omitempty"`
+		SubmittedAt time.Time `json:"submitted_at"`
+		StartedAt   time.Time `json:"started_at"`
+		FinishedAt  time.Time `json:"finished_at"`
+	}
+	// JobConfig configures how a collection of commands runs jobs.
+	JobConfig struct {
+		// Workers is the maximum number of jobs run at once. It is at least 1.
+		Workers int
+		// History is the maximum number of finished jobs kept. Negative values are treated as 0.
+		History int
+	}
+	// jobRunner runs submitted commands on a bounded number of workers.
+	jobRunner struct {
+		mu       sync.Mutex
+		cfg      JobConfig
+		jobs     map[JobID]*jobState
+		order    []JobID
+		pending  []*jobState
+		running  int
+		watchers map[uint64]func(Job)
+		nextID   uint64
+	}
+	// jobState is a job with its command and the means to cancel it.
+	jobState struct {
+		job    Job
+		exec   CommandHandler
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+	// progressKey is the context key of a job's progress reporter.
+	progressKey struct{}
+)
+
+// WithWorkers sets the maximum number of jobs run at once.
+func WithWorkers(n int) Opt[JobConfig] {
+	return func(c *JobConfig) {
+		c.Workers = n
+	}
+}
+
+// WithJobHistory sets the maximum number of finished jobs kept.
+func WithJobHistory(n int) Opt[JobConfig] {
+	return func(c *JobConfig) {
+		c.History = n
+	}
+}
+
+// ReportProgress reports the progress of the job running a command. It does
+// nothing if the command was not submitted as a job.
+func ReportProgress(ctx context.Context, progress float64, message string) {
+	if fn, ok := ctx.Value(progressKey{}).(func(float64, string)); ok {
+		fn(progress, message)
+	}
+}
+
+// ConfigureJobs configures how the collection runs jobs. Jobs already
+// submitted keep their place in the queue.
+func (c *Commands) ConfigureJobs(opts ...Opt[JobConfig]) {
+	r := c.jobRunner()
+	r.mu.Lock()
+	for _, o := range opts {
+		o(&r.cfg)
+	}
+	// without a worker no job would ever be dispatched
+	r.cfg.Workers = max(r.cfg.Workers, 1)
+	r.cfg.History = max(r.cfg.History, 0)
+	r.mu.Unlock()
+	r.dispatch()
+}
+
+// Submit queues a command to run in the background and returns its job's id.
+func (c *Commands) Submit(key CommandKey, args any) (JobID, error) {
+	cmd, err := c.get(key)
+	if err != nil {
+		return "", err
+	}
+	r := c.jobRunner()
+	s := &jobState{
+		job: Job{
+			ID:          JobID(uuid.New().String()),
+			Command:     key,
+			Args:        args,
+			Status:      JobQueued,
+			SubmittedAt: time.Now(),
+		},
+		exec: func(ctx context.Context, args any) (any, error) {
+			return c.run(ctx, key, cmd, args)
+		},
+		done: make(chan struct{}),
+	}
+	r.mu.Lock()
+	r.jobs[s.job.ID] = s
+	r.order = append(r.order, s.job.ID)
+	r.pending = append(r.pending, s)
+	r.notify(s.job)
+	r.mu.Unlock()
+	r.dispatch()
+	return s.job.ID, nil
+}
+
+// Job returns a job by id.
+func (c *Commands) Job(id JobID) (Job, bool) {
+	r := c.jobRunner()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return s.job, true
+}
+
+// Jobs returns every job kept by the collection in order of submission.
+func (c *Commands) Jobs() []Job {
+	r := c.jobRunner()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]Job, 0, len(r.order))
+	for _, id := range r.order {
+		jobs = append(jobs, r.jobs[id].job)
+	}
+	return jobs
+}
+
+// Wait waits for a job to finish and returns it.
+func (c *Commands) Wait(ctx context.Context, id JobID) (Job, error) {
+	r := c.jobRunner()
+	r.mu.Lock()
+	s, ok := r.jobs[id]
+	r.mu.Unlock()
+	if !ok {
+		return Job{}, NewError[Commands](fmt.Sprintf("no job with id '%s'", id))
+	}
+	select {
+	case <-s.done:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return s.job, nil
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+}
+
+// Cancel cancels a queued or running job.
+func (c *Commands) Cancel(id JobID) error {
+	r := c.jobRunner()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.jobs[id]
+	if !ok {
+		return NewError[Commands](fmt.Sprintf("no job with id '%s'", id))
+	}
+	switch s.job.Status {
+	case JobQueued:
+		for i, p := range r.pending {
+			if p == s {
+				r.pending = append(r.pending[:i], r.pending[i+1:]...)
+				break
+			}
+		}
+		r.finish(s, nil, context.Canceled)
+	case JobRunning:
+		s.cancel()
+	default:
+		return NewError[Commands](fmt.Sprintf("job '%s' has already finished", id))
+	}
+	return nil
+}
+
+// WatchJobs calls fn with a job every time one is submitted, makes progress or
+// finishes, and returns a function that stops watching.
+//
+// fn is called while jobs are locked, so it must not block or call back into the collection.
+func (c *Commands) WatchJobs(fn func(Job)) (cancel func()) {
+	r := c.jobRunner()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	id := r.nextID
+	r.watchers[id] = fn
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.watchers, id)
+	}
+}
+
+// jobRunner returns the collection's job runner, creating it on first use.
+func (c *Commands) jobRunner() *jobRunner {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.jobs == nil {
+		c.jobs = &jobRunner{
+			cfg:      JobConfig{Workers: 4, History: 100},
+			jobs:     make(map[JobID]*jobState),
+			watchers: make(map[uint64]func(Job)),
+		}
+	}
+	return c.jobs
+}
+
+// dispatch starts queued jobs while there are free workers.
+func (r *jobRunner) dispatch() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.running < r.cfg.Workers && len(r.pending) > 0 {
+		s := r.pending[0]
+		r.pending = r.pending[1:]
+		r.running++
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancel = cancel
+		s.job.Status = JobRunning
+		s.job.StartedAt = time.Now()
+		r.notify(s.job)
+		go r.run(ctx, s)
+	}
+}
+
+// run runs a job's command and starts the next queued job when it finishes.
+func (r *jobRunner) run(ctx context.Context, s *jobState) {
+	ctx = context.WithValue(ctx, progressKey{}, func(progress float64, message string) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if s.job.Status != JobRunning {
+			return
+		}
+		s.job.Progress = progress
+		s.job.Message = message
+		r.notify(s.job)
+	})
+	result, err := s.exec(ctx, s.job.Args)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		err = context.Canceled
+	}
+	s.cancel()
+
+	r.mu.Lock()
+	r.running--
+	r.finish(s, result, err)
+	r.mu.Unlock()
+	r.dispatch()
+}
+
+// finish records the outcome of a job and trims the job history.
+//
+// The caller must hold r.mu.
+func (r *jobRunner) finish(s *jobState, result any, err error) {
+	s.job.FinishedAt = time.Now()
+	switch {
+	case errors.Is(err, context.Canceled):
+		s.job.Status = JobCanceled
+		s.job.Error = err.Error()
+	case err != nil:
+		s.job.Status = JobFailed
+		s.job.Error = err.Error()
+	default:
+		s.job.Status = JobSucceeded
+		s.job.Progress = 1
+		s.job.Result = result
+	}
+	r.notify(s.job)
+	close(s.done)
+
+	finished := 0
+	for _, id := range r.order {
+		if r.jobs[id].finished() {
+			finished++
+		}
+	}
+	order := r.order[:0]
+	for _, id := range r.order {
+		if finished > r.cfg.History && r.jobs[id].finished() {
+			delete(r.jobs, id)
+			finished--
+			continue
+		}
+		order = append(order, id)
+	}
+	r.order = order
+}
+
+// notify calls every watcher with a job.
+//
+// The caller must hold r.mu.
+func (r *jobRunner) notify(job Job) {
+	for _, fn := range r.watchers {
+		fn(job)
+	}
+}
+
+func (s *jobState) finished() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// jobsMessage is sent to websocket clients watching the jobs of a store.
+type jobsMessage struct {
+	Type  string   `json:"type"`
+	Store StoreKey `json:"store"`
+	Jobs  []Job    `json:"jobs,omitempty"`
+	Job   *Job     `json:"job,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// HandleJobs responds with the jobs of the store given by the 'store' query
+// parameter, or a single job if an 'id' is given.
+func (s *Server) HandleJobs(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(StoreKey(r.URL.Query().Get("store")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if id := r.URL.Query().Get("id"); id != "" {
+		job, ok := store.Commands().Job(JobID(id))
+		if !ok {
+			http.Error(w, fmt.Sprintf("no job with id '%s'", id), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(job)
+		return
+	}
+	json.NewEncoder(w).Encode(store.Commands().Jobs())
+}
+
+// watchJobs sends a websocket connection the jobs of a store followed by
+// every change to them until the connection is closed.
+func (s *Server) watchJobs(c *Conn, key StoreKey) {
+	store, err := s.store(key)
+	if err != nil {
+		c.send(jobsMessage{Type: "jobs", Store: key, Error: err.Error()})
+		return
+	}
+	cmds := store.Commands()
+	r := cmds.jobRunner()
+	// hold the runner's lock so no change is missed between the list and the watch
+	r.mu.Lock()
+	jobs := make([]Job, 0, len(r.order))
+	for _, id := range r.order {
+		jobs = append(jobs, r.jobs[id].job)
+	}
+	c.send(jobsMessage{Type: "jobs", Store: key, Jobs: jobs})
+	r.nextID++
+	id := r.nextID
+	r.watchers[id] = func(job Job) {
+		c.send(jobsMessage{Type: "job", Store: key, Job: &job})
+	}
+	r.mu.Unlock()
+	c.onClosed(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.watchers, id)
+	})
+}
@@ -0,0 +1,215 @@
+package mnemo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSubmit(t *testing.T) {
+	cmds := NewCommands()
+	cmds.Register("sum", Handler(func(ctx context.Context, args []int) (int, error) {
+		ReportProgress(ctx, 0.5, "halfway")
+		return args[0] + args[1], nil
+	}))
+	cmds.Register("fail", func(ctx context.Context, args any) (any, error) {
+		return nil, errors.New("failed")
+	})
+
+	var mu sync.Mutex
+	var seen []JobStatus
+	stop := cmds.WatchJobs(func(job Job) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, job.Status)
+	})
+	defer stop()
+
+	id, err := cmds.Submit("sum", []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := cmds.Wait(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobSucceeded || job.Result != 3 || job.Progress != 1 {
+		t.Errorf("unexpected job %+v", job)
+	}
+	mu.Lock()
+	want := []JobStatus{JobQueued, JobRunning, JobRunning, JobSucceeded}
+	if len(seen) != len(want) {
+		t.Errorf("expected statuses %v; got %v", want, seen)
+	}
+	mu.Unlock()
+
+	id, _ = cmds.Submit("fail", nil)
+	job, _ = cmds.Wait(context.Background(), id)
+	if job.Status != JobFailed || job.Error != "failed" {
+		t.Errorf("expected failed job; got %+v", job)
+	}
+	if _, err := cmds.Submit("missing", nil); err == nil {
+		t.Error("expected error submitting missing command")
+	}
+	if jobs := cmds.Jobs(); len(jobs) != 2 || jobs[0].Command != "sum" {
+		t.Errorf("expected jobs in order of submission; got %+v", jobs)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	cmds := NewCommands()
+	cmds.ConfigureJobs(WithWorkers(1))
+	started := make(chan struct{})
+	cmds.Register("block", func(ctx context.Context, args any) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, errors.New("stopped")
+	})
+	cmds.Register("noop", func(ctx context.Context, args any) (any, error) {
+		return nil, nil
+	})
+
+	running, _ := cmds.Submit("block", nil)
+	queued, _ := cmds.Submit("noop", nil)
+	<-started
+	if job, _ := cmds.Job(queued); job.Status != JobQueued {
+		t.Errorf("expected job to wait for a free worker; got %s", job.Status)
+	}
+	if err := cmds.Cancel(queued); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmds.Cancel(running); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []JobID{queued, running} {
+		job, _ := cmds.Wait(context.Background(), id)
+		if job.Status != JobCanceled {
+			t.Errorf("expected canceled job; got %+v", job)
+		}
+	}
+	if err := cmds.Cancel(running); err == nil {
+		t.Error("expected error canceling a finished job")
+	}
+}
+
+func TestJobWorkersAtLeastOne(t *testing.T) {
+	cmds := NewCommands()
+	cmds.ConfigureJobs(WithWorkers(0))
+	cmds.Register("noop", func(ctx context.Context, args any) (any, error) {
+		return nil, nil
+	})
+	id, _ := cmds.Submit("noop", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if job, err := cmds.Wait(ctx, id); err != nil || job.Status != JobSucceeded {
+		t.Errorf("expected job to run with at least one worker; got %+v, %v", job, err)
+	}
+}
+
+func TestJobHistory(t *testing.T) {
+	cmds := NewCommands()
+	cmds.ConfigureJobs(WithJobHistory(2))
+	cmds.Register("noop", func(ctx context.Context, args any) (any, error) {
+		return nil, nil
+	})
+	var ids []JobID
+	for i := 0; i < 4; i++ {
+		id, _ := cmds.Submit("noop", nil)
+		cmds.Wait(context.Background(), id)
+		ids = append(ids, id)
+	}
+	if jobs := cmds.Jobs(); len(jobs) != 2 || jobs[0].ID != ids[2] {
+		t.Errorf("expected the last 2 jobs to be kept; got %+v", jobs)
+	}
+	if _, ok := cmds.Job(ids[0]); ok {
+		t.Error("expected oldest job to be removed")
+	}
+}
+
+func TestJobsServer(t *testing.T) {
+	var key StoreKey = "jobs_store"
+	store, _ := NewStore(key)
+	release := make(chan struct{})
+	store.Commands().Register("wait", func(ctx context.Context, args any) (any, error) {
+		<-release
+		return "done", nil
+	})
+	m := New().WithServer("jobs", WithPort(8211), WithSilence())
+	m.WithStores(key)
+	m.Server().ListenAndServe()
+	t.Cleanup(func() { m.Server().Shutdown() })
+
+	var ws *websocket.Conn
+	waitForNoError(t, func() error {
+		var err error
+		ws, _, err = websocket.DefaultDialer.Dial(m.Server().URL()+"/subscribe", nil)
+		return err
+	})
+	defer ws.Close()
+	ws.WriteJSON(map[string]any{"type": "jobs", "store": key})
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	read := func(typ string) jobsMessage {
+		t.Helper()
+		for {
+			var msg jobsMessage
+			if err := ws.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type == typ {
+				return msg
+			}
+		}
+	}
+	if msg := read("jobs"); msg.Error != "" || len(msg.Jobs) != 0 {
+		t.Fatalf("unexpected jobs message %+v", msg)
+	}
+
+	id, _ := store.Commands().Submit("wait", nil)
+	close(release)
+	for {
+		msg := read("job")
+		if msg.Job.ID != id {
+			t.Fatalf("unexpected job %+v", msg.Job)
+		}
+		if msg.Job.Status == JobSucceeded {
+			break
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	m.Server().HandleJobs(rec, httptest.NewRequest(http.MethodGet, "/jobs?store=jobs_store&id="+string(id), nil))
+	var job Job
+	json.NewDecoder(rec.Body).Decode(&job)
+	if rec.Code != http.StatusOK || job.Result != "done" {
+		t.Errorf("unexpected http response %d %+v", rec.Code, job)
+	}
+	rec = httptest.NewRecorder()
+	m.Server().HandleJobs(rec, httptest.NewRequest(http.MethodGet, "/jobs?store=missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected not found for missing store; got %d", rec.Code)
+	}
+}
+
+func TestWatchJobsClosedConn(t *testing.T) {
+	var key StoreKey = "jobs_closed_store"
+	store, _ := NewStore(key)
+	m := New().WithServer("jobs_closed", WithPort(8220), WithSilence())
+	m.WithStores(key)
+
+	c := newTestConns(t, 1)[0]
+	c.Close()
+	m.Server().watchJobs(c, key)
+	r := store.Commands().jobRunner()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.watchers) != 0 {
+		t.Errorf("expected no watchers on a closed connection; got %d", len(r.watchers))
+	}
+}
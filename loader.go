@@ -0,0 +1,325 @@
+package mnemo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// LoaderFunc loads an item missing from a cache from its source of truth.
+	LoaderFunc[T any] func(ctx context.Context, key CacheKey) (T, error)
+	// LoaderConfig configures a cache's loader.
+	LoaderConfig struct {
+		// NegativeTTL is how long a loader error is cached for a key.
+		// Errors are not cached if it is 0.
+		NegativeTTL time.Duration
+		// SoftTTL is how long a loaded item is fresh. A stale item is still
+		// returned but is reloaded in the background. Items never go stale if it is 0.
+		SoftTTL time.Duration
+		// HardTTL is how long a loaded item is kept. Items never expire if it is 0.
+		HardTTL time.Duration
+		// RefreshAhead is how long before going stale, or expiring if there is no
+		// SoftTTL, a hot item is reloaded. Items are not refreshed ahead if it is 0.
+		RefreshAhead time.Duration
+		// RefreshHits is how many reads since it was loaded make an item hot.
+		RefreshHits int
+	}
+	// loader loads missing items into a cache and collapses concurrent loads
+	// of the same key into one.
+	loader[T any] struct {
+		mu       sync.Mutex
+		fn       LoaderFunc[T]
+		cfg      LoaderConfig
+		flights  map[CacheKey]*flight[T]
+		failures map[CacheKey]loadFailure
+		// loaded tracks the age and reads of items cached by the loader.
+		loaded map[CacheKey]*loadedItem
+		cancel func()
+		stop   chan struct{}
+	}
+	// loadedItem is the age and number of reads of a loaded item.
+	loadedItem struct {
+		at   time.Time
+		hits int
+	}
+	// flight is a load in progress.
+	flight[T any] struct {
+		done chan struct{}
+		// base is the item cached by the key when the flight started, or nil if it was missing.
+		base *Item[T]
+		item Item[T]
+		err  error
+	}
+	// loadFailure is a cached loader error.
+	loadFailure struct {
+		err   error
+		until time.Time
+	}
+)
+
+// WithNegativeTTL caches loader errors for d so failing keys are not reloaded on every miss.
+func WithNegativeTTL(d time.Duration) Opt[LoaderConfig] {
+	return func(c *LoaderConfig) {
+		c.NegativeTTL = d
+	}
+}
+
+// WithSoftTTL makes loaded items stale after d. Stale items are returned while
+// they are reloaded in the background.
+func WithSoftTTL(d time.Duration) Opt[LoaderConfig] {
+	return func(c *LoaderConfig) {
+		c.SoftTTL = d
+	}
+}
+
+// WithHardTTL removes loaded items from the cache d after they were loaded.
+func WithHardTTL(d time.Duration) Opt[LoaderConfig] {
+	return func(c *LoaderConfig) {
+		c.HardTTL = d
+	}
+}
+
+// WithRefreshAhead reloads items read at least hits times since they were loaded
+// when they are within window of going stale, or of expiring if there is no soft TTL.
+func WithRefreshAhead(window time.Duration, hits int) Opt[LoaderConfig] {
+	return func(c *LoaderConfig) {
+		c.RefreshAhead = window
+		c.RefreshHits = hits
+	}
+}
+
+// SetLoader sets the function GetOrLoad uses to load missing items.
+//
+// Loaded items are subject to the loader's soft and hard TTLs until they are
+// written by anything other than the loader. Reloaded items are committed like
+// any other write, so they appear in the cache's history and feeds.
+func (c *Cache[T]) SetLoader(fn LoaderFunc[T], opts ...Opt[LoaderConfig]) {
+	l := &loader[T]{
+		fn:       fn,
+		flights:  make(map[CacheKey]*flight[T]),
+		failures: make(map[CacheKey]loadFailure),
+		loaded:   make(map[CacheKey]*loadedItem),
+		stop:     make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(&l.cfg)
+	}
+	c.mu.Lock()
+	prev := c.loader
+	c.loader = l
+	l.cancel = c.listenLocked(func(m mutation[T]) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if m.Source == sourceLoader && m.Op != opDelete {
+			l.loaded[m.Key] = &loadedItem{at: time.Now()}
+			return
+		}
+		delete(l.loaded, m.Key)
+	})
+	c.mu.Unlock()
+
+	if prev != nil {
+		prev.cancel()
+		close(prev.stop)
+	}
+	if interval := l.cfg.interval(); interval > 0 {
+		go c.maintain(l, interval)
+	}
+}
+
+// GetOrLoad returns the item cached by key, loading and caching it with the
+// cache's loader if it is missing.
+//
+// Concurrent calls for the same missing key share a single load. The load is not
+// cancelled if ctx is, but GetOrLoad returns ctx's error as soon as ctx is done.
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key CacheKey) (_ Item[T], err error) {
+	ctx, span := startSpan(ctx, "mnemo.cache.get_or_load", Attr("key", key))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	c.mu.Lock()
+	l := c.loader
+	item, ok := c.lookup(key)
+	c.metrics.countLookup(ok)
+	c.mu.Unlock()
+	span.SetAttributes(Attr("hit", ok))
+	if ok {
+		return *item, nil
+	}
+	if l == nil {
+		return *new(Item[T]), NewError[Cache[T]]("cache has no loader")
+	}
+
+	f, err := c.load(ctx, l, key, nil)
+	if err != nil {
+		return *new(Item[T]), err
+	}
+	select {
+	case <-f.done:
+		return f.item, f.err
+	case <-ctx.Done():
+		return *new(Item[T]), ctx.Err()
+	}
+}
+
+// load returns the flight loading key, starting one if none is in progress.
+//
+// base is the item cached by key when the load was decided on, or nil if it was
+// missing. The loaded item is only cached if key is not written in the meantime.
+func (c *Cache[T]) load(ctx context.Context, l *loader[T], key CacheKey, base *Item[T]) (*flight[T], error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f, ok := l.failures[key]; ok {
+		if time.Now().Before(f.until) {
+			return nil, f.err
+		}
+		delete(l.failures, key)
+	}
+	if f, ok := l.flights[key]; ok {
+		return f, nil
+	}
+
+	f := &flight[T]{done: make(chan struct{}), base: base}
+	l.flights[key] = f
+	go func() {
+		data, err := l.fn(context.WithoutCancel(ctx), key)
+		if err == nil {
+			f.item, err = c.storeLoaded(key, data, f.base)
+		}
+		f.err = err
+
+		l.mu.Lock()
+		delete(l.flights, key)
+		if err != nil && l.cfg.NegativeTTL > 0 {
+			l.failures[key] = loadFailure{err: err, until: time.Now().Add(l.cfg.NegativeTTL)}
+		}
+		l.mu.Unlock()
+		close(f.done)
+	}()
+	return f, nil
+}
+
+// storeLoaded caches loaded data unless key was written since base, the item
+// cached by key when the load started, in which case the newer write is kept
+// and returned. Data loaded for a key deleted while it was reloaded is returned
+// without being cached.
+//
+// Loaded items are not written to the cache's sink.
+func (c *Cache[T]) storeLoaded(key CacheKey, data T, base *Item[T]) (Item[T], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev, ok := c.raw.caches[key]
+	unchanged := !ok && base == nil ||
+		ok && base != nil && prev.Version == base.Version && prev.UpdatedAt.Equal(base.UpdatedAt)
+	if !unchanged {
+		if ok {
+			return *prev, nil
+		}
+		return Item[T]{Data: &data}, nil
+	}
+	if ok {
+		return c.replace(key, prev, &data, sourceLoader)
+	}
+	return c.insert(key, &data, sourceLoader)
+}
+
+// lookup returns the item cached by key, applying the loader's TTLs to loaded items.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) lookup(key CacheKey) (*Item[T], bool) {
+	item, ok := c.raw.caches[key]
+	if !ok || c.loader == nil {
+		return item, ok
+	}
+	l := c.loader
+	l.mu.Lock()
+	li, tracked := l.loaded[key]
+	var age time.Duration
+	if tracked {
+		li.hits++
+		age = time.Since(li.at)
+	}
+	l.mu.Unlock()
+	if !tracked {
+		return item, true
+	}
+
+	if l.cfg.HardTTL > 0 && age >= l.cfg.HardTTL {
+		if _, err := c.remove(key, sourceExpiry); err != nil {
+			NewError[Cache[T]](err.Error()).Log()
+		}
+		return nil, false
+	}
+	if l.cfg.SoftTTL > 0 && age >= l.cfg.SoftTTL {
+		base := *item
+		c.load(context.Background(), l, key, &base)
+	}
+	return item, true
+}
+
+// maintain removes expired loaded items and refreshes hot items ahead of time
+// until the loader is replaced.
+func (c *Cache[T]) maintain(l *loader[T], interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var expired []CacheKey
+		refresh := make(map[CacheKey]*Item[T])
+		c.mu.Lock()
+		l.mu.Lock()
+		for key, li := range l.loaded {
+			age := time.Since(li.at)
+			switch {
+			case l.cfg.HardTTL > 0 && age >= l.cfg.HardTTL:
+				expired = append(expired, key)
+			case l.cfg.RefreshAhead > 0 && li.hits >= l.cfg.RefreshHits && age >= l.cfg.refreshAt():
+				if item, ok := c.raw.caches[key]; ok {
+					base := *item
+					refresh[key] = &base
+				}
+			}
+		}
+		l.mu.Unlock()
+		for _, key := range expired {
+			if _, err := c.remove(key, sourceExpiry); err != nil {
+				NewError[Cache[T]](err.Error()).Log()
+			}
+		}
+		c.mu.Unlock()
+		for key, base := range refresh {
+			c.load(context.Background(), l, key, base)
+		}
+	}
+}
+
+// refreshAt is the age at which hot items are refreshed ahead.
+func (c LoaderConfig) refreshAt() time.Duration {
+	ttl := c.SoftTTL
+	if ttl == 0 {
+		ttl = c.HardTTL
+	}
+	return max(ttl-c.RefreshAhead, 0)
+}
+
+// interval is how often loaded items are checked for expiry and refresh,
+// or 0 if they never need to be.
+func (c LoaderConfig) interval() time.Duration {
+	var d time.Duration
+	for _, ttl := range []time.Duration{c.SoftTTL, c.HardTTL, c.RefreshAhead} {
+		if ttl > 0 && (d == 0 || ttl < d) {
+			d = ttl
+		}
+	}
+	if c.HardTTL == 0 && c.RefreshAhead == 0 {
+		return 0
+	}
+	return max(d/4, 10*time.Millisecond)
+}
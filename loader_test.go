@@ -0,0 +1,203 @@
+package mnemo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	cache := newCache[string]()
+	var loads atomic.Int32
+	release := make(chan struct{})
+	cache.SetLoader(func(ctx context.Context, key CacheKey) (string, error) {
+		loads.Add(1)
+		<-release
+		return "loaded", nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, err := cache.GetOrLoad(context.Background(), "key")
+			if err != nil || *item.Data != "loaded" {
+				t.Errorf("expected loaded item; got %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if loads.Load() != 1 {
+		t.Errorf("expected concurrent misses to share one load; got %d", loads.Load())
+	}
+	if _, ok := cache.Get("key"); !ok {
+		t.Error("expected loaded item to be cached")
+	}
+
+	cache.GetOrLoad(context.Background(), "key")
+	if loads.Load() != 1 {
+		t.Error("expected cached item not to be reloaded")
+	}
+}
+
+func TestGetOrLoadNegativeTTL(t *testing.T) {
+	cache := newCache[string]()
+	errMissing := errors.New("missing")
+	var loads atomic.Int32
+	cache.SetLoader(func(ctx context.Context, key CacheKey) (string, error) {
+		loads.Add(1)
+		return "", errMissing
+	}, WithNegativeTTL(50*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.GetOrLoad(context.Background(), "key"); err != errMissing {
+			t.Errorf("expected loader error; got %v", err)
+		}
+	}
+	if loads.Load() != 1 {
+		t.Errorf("expected error to be cached; got %d loads", loads.Load())
+	}
+	time.Sleep(60 * time.Millisecond)
+	cache.GetOrLoad(context.Background(), "key")
+	if loads.Load() != 2 {
+		t.Error("expected key to be reloaded after negative ttl")
+	}
+}
+
+func TestGetOrLoadContext(t *testing.T) {
+	cache := newCache[string]()
+	if _, err := cache.GetOrLoad(context.Background(), "key"); err == nil {
+		t.Error("expected error without loader")
+	}
+	release := make(chan struct{})
+	defer close(release)
+	cache.SetLoader(func(ctx context.Context, key CacheKey) (string, error) {
+		<-release
+		return "late", nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := cache.GetOrLoad(ctx, "key"); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded; got %v", err)
+	}
+}
+
+func TestGetOrLoadConcurrentWrite(t *testing.T) {
+	cache := newCache[int]()
+	started, release := make(chan struct{}), make(chan struct{})
+	cache.SetLoader(func(ctx context.Context, key CacheKey) (int, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+	loaded := make(chan Item[int])
+	go func() {
+		item, _ := cache.GetOrLoad(context.Background(), "key")
+		loaded <- item
+	}()
+	<-started
+	cache.Set("key", 99)
+	close(release)
+	if item := <-loaded; *item.Data != 99 {
+		t.Errorf("expected write made during the load to be returned; got %d", *item.Data)
+	}
+	if item, _ := cache.Get("key"); *item.Data != 99 {
+		t.Errorf("expected write made during the load to be kept; got %d", *item.Data)
+	}
+
+	// reloads of stale items do not overwrite writes made since they went stale
+	base, _ := cache.Get("key")
+	cache.Set("key", 100)
+	if item, err := cache.storeLoaded("key", 2, &base); err != nil || *item.Data != 100 {
+		t.Errorf("expected newer write to be kept; got %v, %v", item.Data, err)
+	}
+}
+
+func TestLoaderSoftTTL(t *testing.T) {
+	cache := newCache[int]()
+	var loads atomic.Int32
+	cache.SetLoader(func(ctx context.Context, key CacheKey) (int, error) {
+		return int(loads.Add(1)), nil
+	}, WithSoftTTL(50*time.Millisecond))
+
+	cache.GetOrLoad(context.Background(), "key")
+	time.Sleep(60 * time.Millisecond)
+	item, ok := cache.Get("key")
+	if !ok || *item.Data != 1 {
+		t.Fatal("expected stale item to be returned")
+	}
+	waitFor(t, time.Second, func() bool {
+		item, _ := cache.Get("key")
+		return *item.Data == 2
+	})
+	if loads.Load() != 2 {
+		t.Errorf("expected one background refresh; got %d loads", loads.Load())
+	}
+}
+
+func TestLoaderHardTTL(t *testing.T) {
+	cache := newCache[int]()
+	cache.SetLoader(func(ctx context.Context, key CacheKey) (int, error) {
+		return 1, nil
+	}, WithHardTTL(50*time.Millisecond))
+
+	cache.GetOrLoad(context.Background(), "loaded")
+	two := 2
+	cache.Cache("local", &two)
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := cache.Get("loaded"); ok {
+		t.Error("expected loaded item to expire")
+	}
+	if _, ok := cache.Get("local"); !ok {
+		t.Error("expected locally cached item not to expire")
+	}
+}
+
+func TestLoaderRefreshAhead(t *testing.T) {
+	cache := newCache[int]()
+	loads := make(map[CacheKey]int)
+	var mu sync.Mutex
+	cache.SetLoader(func(ctx context.Context, key CacheKey) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loads[key]++
+		return loads[key], nil
+	}, WithHardTTL(200*time.Millisecond), WithRefreshAhead(150*time.Millisecond, 3))
+	cache.SetReducer(cache.DefaultReducer)
+	feed := cache.ReducerFeed()
+
+	cache.GetOrLoad(context.Background(), "hot")
+	cache.GetOrLoad(context.Background(), "cold")
+	for i := 0; i < 3; i++ {
+		cache.Get("hot")
+	}
+	waitFor(t, time.Second, func() bool {
+		item, ok := cache.Get("hot")
+		return ok && *item.Data > 1
+	})
+	mu.Lock()
+	if loads["cold"] != 1 {
+		t.Errorf("expected cold key not to be refreshed; got %d loads", loads["cold"])
+	}
+	mu.Unlock()
+
+	refreshed := false
+	for !refreshed {
+		select {
+		case f := <-feed:
+			for _, r := range f.Cache {
+				if r.Key == "hot" && r.Data.(int) > 1 {
+					refreshed = true
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected refreshed value in reducer feed")
+		}
+	}
+}
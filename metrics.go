@@ -0,0 +1,382 @@
+package mnemo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	Counter MetricType = "counter"
+	Gauge   MetricType = "gauge"
+	// Summary metrics are reported as a '_sum' and a '_count' sample.
+	Summary MetricType = "summary"
+)
+
+type (
+	// MetricType is the type of a metric in the Prometheus text format.
+	MetricType string
+	// Metric is a single sample of a metric.
+	Metric struct {
+		Name   string
+		Help   string
+		Type   MetricType
+		Labels map[string]string
+		Value  float64
+	}
+	// Collector collects metrics when they are gathered.
+	Collector interface {
+		Collect() []Metric
+	}
+	// CollectorFunc is a function that implements Collector.
+	CollectorFunc func() []Metric
+	// CacheMetrics are the metrics of a cache.
+	CacheMetrics struct {
+		Hits   uint64
+		Misses uint64
+		Items  int
+		// Evictions are items removed on behalf of other instances, by
+		// invalidation or partition rebalancing.
+		Evictions uint64
+		// Expirations are items removed because they timed out.
+		Expirations   uint64
+		Reductions    uint64
+		ReductionTime time.Duration
+		// HistorySize is the number of entries in the cache's history.
+		HistorySize int
+		// Depth is the number of updates waiting to be read from each feed.
+		RawFeedDepth     int
+		ReducerFeedDepth int
+		DiffFeedDepth    int
+		// Dropped is the number of updates dropped from each feed because it was full.
+		RawFeedDropped     uint64
+		ReducerFeedDropped uint64
+		DiffFeedDropped    uint64
+	}
+	// CommandMetrics are the metrics of a command.
+	CommandMetrics struct {
+		Executions uint64
+		Errors     uint64
+		Time       time.Duration
+	}
+	// ServerMetrics are the metrics of a server.
+	ServerMetrics struct {
+		Connections int
+		// Accepted and Rejected count requests by their authentication.
+		Accepted    uint64
+		Rejected    uint64
+		Publishes   uint64
+		PublishTime time.Duration
+	}
+	// cacheMetrics counts the events of a cache.
+	cacheMetrics struct {
+		hits, misses             atomic.Uint64
+		evictions, expirations   atomic.Uint64
+		reductions, reduceNanos  atomic.Uint64
+		rawDropped, reducDropped atomic.Uint64
+		diffDropped              atomic.Uint64
+	}
+	// commandMetrics counts the executions of a command.
+	commandMetrics struct {
+		executions, errors, nanos atomic.Uint64
+	}
+	// serverMetrics counts the events of a server.
+	serverMetrics struct {
+		accepted, rejected  atomic.Uint64
+		publishes, pubNanos atomic.Uint64
+	}
+	// metricsCollector is implemented by caches so a server can collect the
+	// metrics of caches of any type.
+	metricsCollector interface {
+		collectMetrics(labels map[string]string) []Metric
+	}
+)
+
+// Collect calls f.
+func (f CollectorFunc) Collect() []Metric {
+	return f()
+}
+
+// Metrics returns the metrics of the cache.
+func (c *Cache[T]) Metrics() CacheMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := CacheMetrics{
+		Hits:               c.metrics.hits.Load(),
+		Misses:             c.metrics.misses.Load(),
+		Items:              len(c.raw.caches),
+		Evictions:          c.metrics.evictions.Load(),
+		Expirations:        c.metrics.expirations.Load(),
+		Reductions:         c.metrics.reductions.Load(),
+		ReductionTime:      time.Duration(c.metrics.reduceNanos.Load()),
+		HistorySize:        len(c.raw.index),
+		RawFeedDepth:       len(c.raw.feed),
+		ReducerFeedDepth:   len(c.reducer.feed),
+		RawFeedDropped:     c.metrics.rawDropped.Load(),
+		ReducerFeedDropped: c.metrics.reducDropped.Load(),
+		DiffFeedDropped:    c.metrics.diffDropped.Load(),
+	}
+	if c.diffs != nil {
+		m.DiffFeedDepth = len(c.diffs)
+	}
+	return m
+}
+
+// collectMetrics returns the metrics of the cache with labels.
+func (c *Cache[T]) collectMetrics(labels map[string]string) []Metric {
+	m := c.Metrics()
+	feed := func(name string) map[string]string {
+		return withLabel(labels, "feed", name)
+	}
+	return []Metric{
+		{Name: "mnemo_cache_hits_total", Help: "Cache lookups that found an item.", Type: Counter, Labels: labels, Value: float64(m.Hits)},
+		{Name: "mnemo_cache_misses_total", Help: "Cache lookups that found no item.", Type: Counter, Labels: labels, Value: float64(m.Misses)},
+		{Name: "mnemo_cache_items", Help: "Items in the cache.", Type: Gauge, Labels: labels, Value: float64(m.Items)},
+		{Name: "mnemo_cache_evictions_total", Help: "Items removed on behalf of other instances.", Type: Counter, Labels: labels, Value: float64(m.Evictions)},
+		{Name: "mnemo_cache_expirations_total", Help: "Items removed because they timed out.", Type: Counter, Labels: labels, Value: float64(m.Expirations)},
+		{Name: "mnemo_cache_reduction_seconds_sum", Help: "Time spent reducing the cache.", Type: Summary, Labels: labels, Value: m.ReductionTime.Seconds()},
+		{Name: "mnemo_cache_reduction_seconds_count", Help: "Time spent reducing the cache.", Type: Summary, Labels: labels, Value: float64(m.Reductions)},
+		{Name: "mnemo_cache_history_entries", Help: "Entries in the cache's history.", Type: Gauge, Labels: labels, Value: float64(m.HistorySize)},
+		{Name: "mnemo_cache_feed_depth", Help: "Updates waiting to be read from a feed.", Type: Gauge, Labels: feed("raw"), Value: float64(m.RawFeedDepth)},
+		{Name: "mnemo_cache_feed_depth", Help: "Updates waiting to be read from a feed.", Type: Gauge, Labels: feed("reducer"), Value: float64(m.ReducerFeedDepth)},
+		{Name: "mnemo_cache_feed_depth", Help: "Updates waiting to be read from a feed.", Type: Gauge, Labels: feed("diff"), Value: float64(m.DiffFeedDepth)},
+		{Name: "mnemo_cache_feed_dropped_total", Help: "Updates dropped because a feed was full.", Type: Counter, Labels: feed("raw"), Value: float64(m.RawFeedDropped)},
+		{Name: "mnemo_cache_feed_dropped_total", Help: "Updates dropped because a feed was full.", Type: Counter, Labels: feed("reducer"), Value: float64(m.ReducerFeedDropped)},
+		{Name: "mnemo_cache_feed_dropped_total", Help: "Updates dropped because a feed was full.", Type: Counter, Labels: feed("diff"), Value: float64(m.DiffFeedDropped)},
+	}
+}
+
+// countRemoval counts items removed by expiry or on behalf of other instances.
+func (m *cacheMetrics) countRemoval(op mutationOp, src mutationSource) {
+	if op != opDelete {
+		return
+	}
+	switch src {
+	case sourceExpiry:
+		m.expirations.Add(1)
+	case sourceRemote:
+		m.evictions.Add(1)
+	}
+}
+
+// countLookup counts a cache hit or miss.
+func (m *cacheMetrics) countLookup(hit bool) {
+	if hit {
+		m.hits.Add(1)
+		return
+	}
+	m.misses.Add(1)
+}
+
+// Metrics returns the metrics of the collection's commands by key.
+func (c *Commands) Metrics() map[CommandKey]CommandMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	metrics := make(map[CommandKey]CommandMetrics, len(c.metrics))
+	for k, m := range c.metrics {
+		metrics[k] = CommandMetrics{
+			Executions: m.executions.Load(),
+			Errors:     m.errors.Load(),
+			Time:       time.Duration(m.nanos.Load()),
+		}
+	}
+	return metrics
+}
+
+// count counts an execution of a command.
+func (c *Commands) count(key CommandKey, d time.Duration, err error) {
+	c.mu.Lock()
+	if c.metrics == nil {
+		c.metrics = make(map[CommandKey]*commandMetrics)
+	}
+	m, ok := c.metrics[key]
+	if !ok {
+		m = &commandMetrics{}
+		c.metrics[key] = m
+	}
+	c.mu.Unlock()
+	m.executions.Add(1)
+	m.nanos.Add(uint64(d))
+	if err != nil {
+		m.errors.Add(1)
+	}
+}
+
+// collectMetrics returns the metrics of the collection's commands with labels.
+func (c *Commands) collectMetrics(labels map[string]string) []Metric {
+	all := c.Metrics()
+	keys := make([]CommandKey, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	var metrics []Metric
+	for _, k := range keys {
+		m := all[k]
+		l := withLabel(labels, "command", string(k))
+		metrics = append(metrics,
+			Metric{Name: "mnemo_command_errors_total", Help: "Command executions that returned an error.", Type: Counter, Labels: l, Value: float64(m.Errors)},
+			Metric{Name: "mnemo_command_seconds_sum", Help: "Time spent executing commands.", Type: Summary, Labels: l, Value: m.Time.Seconds()},
+			Metric{Name: "mnemo_command_seconds_count", Help: "Time spent executing commands.", Type: Summary, Labels: l, Value: float64(m.Executions)},
+		)
+	}
+	return metrics
+}
+
+// Metrics returns the metrics of the server.
+func (s *Server) Metrics() ServerMetrics {
+	s.connPool.mu.Lock()
+	conns := len(s.connPool.conns)
+	s.connPool.mu.Unlock()
+	return ServerMetrics{
+		Connections: conns,
+		Accepted:    s.metrics.accepted.Load(),
+		Rejected:    s.metrics.rejected.Load(),
+		Publishes:   s.metrics.publishes.Load(),
+		PublishTime: time.Duration(s.metrics.pubNanos.Load()),
+	}
+}
+
+// RegisterCollector adds a collector to the metrics served by the server.
+func (s *Server) RegisterCollector(c Collector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collectors = append(s.collectors, c)
+}
+
+// Gather collects the metrics of the server, the commands and caches of its
+// Mnemo instance's stores and the server's registered collectors.
+func (s *Server) Gather() []Metric {
+	m := s.Metrics()
+	metrics := []Metric{
+		{Name: "mnemo_server_connections", Help: "Open websocket connections.", Type: Gauge, Value: float64(m.Connections)},
+		{Name: "mnemo_server_requests_total", Help: "Requests by authentication result.", Type: Counter, Labels: map[string]string{"result": "accepted"}, Value: float64(m.Accepted)},
+		{Name: "mnemo_server_requests_total", Help: "Requests by authentication result.", Type: Counter, Labels: map[string]string{"result": "rejected"}, Value: float64(m.Rejected)},
+		{Name: "mnemo_server_publish_seconds_sum", Help: "Time spent publishing messages to connections.", Type: Summary, Value: m.PublishTime.Seconds()},
+		{Name: "mnemo_server_publish_seconds_count", Help: "Time spent publishing messages to connections.", Type: Summary, Value: float64(m.Publishes)},
+	}
+	s.mu.Lock()
+	mnemo := s.mnemo
+	collectors := append([]Collector{}, s.collectors...)
+	s.mu.Unlock()
+	if mnemo != nil {
+		for _, key := range mnemo.storeKeys() {
+			store, err := UseStore(key)
+			if err != nil {
+				continue
+			}
+			labels := map[string]string{"store": string(key)}
+			metrics = append(metrics, store.Commands().collectMetrics(labels)...)
+			for ck, cache := range store.caches() {
+				if mc, ok := cache.(metricsCollector); ok {
+					metrics = append(metrics, mc.collectMetrics(withLabel(labels, "cache", fmt.Sprint(ck)))...)
+				}
+			}
+		}
+	}
+	for _, c := range collectors {
+		metrics = append(metrics, c.Collect()...)
+	}
+	return metrics
+}
+
+// HandleMetrics responds with the server's metrics in the Prometheus text format.
+func (s *Server) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := WritePrometheus(w, s.Gather()); err != nil {
+		NewError[Server](err.Error()).Log()
+	}
+}
+
+// WritePrometheus writes metrics to w in the Prometheus text exposition format.
+//
+// Samples are grouped by metric, in the order each metric first appears.
+func WritePrometheus(w io.Writer, metrics []Metric) error {
+	family := func(m Metric) string {
+		if m.Type == Summary {
+			name := strings.TrimSuffix(m.Name, "_sum")
+			return strings.TrimSuffix(name, "_count")
+		}
+		return m.Name
+	}
+	order := map[string]int{}
+	for _, m := range metrics {
+		if _, ok := order[family(m)]; !ok {
+			order[family(m)] = len(order)
+		}
+	}
+	sorted := append([]Metric{}, metrics...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return order[family(sorted[i])] < order[family(sorted[j])]
+	})
+
+	bw := bufio.NewWriter(w)
+	last := ""
+	for _, m := range sorted {
+		if f := family(m); f != last {
+			last = f
+			if m.Help != "" {
+				fmt.Fprintf(bw, "# HELP %s %s\n", f, escapeHelp(m.Help))
+			}
+			fmt.Fprintf(bw, "# TYPE %s %s\n", f, m.Type)
+		}
+		bw.WriteString(m.Name)
+		if len(m.Labels) > 0 {
+			keys := make([]string, 0, len(m.Labels))
+			for k := range m.Labels {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			bw.WriteByte('{')
+			for i, k := range keys {
+				if i > 0 {
+					bw.WriteByte(',')
+				}
+				fmt.Fprintf(bw, "%s=\"%s\"", k, escapeLabel(m.Labels[k]))
+			}
+			bw.WriteByte('}')
+		}
+		bw.WriteByte(' ')
+		bw.WriteString(formatValue(m.Value))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// formatValue formats a sample value as Prometheus expects.
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+// withLabel returns a copy of labels with a label added.
+func withLabel(labels map[string]string, key, value string) map[string]string {
+	l := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		l[k] = v
+	}
+	l[key] = value
+	return l
+}
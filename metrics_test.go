@@ -0,0 +1,144 @@
+package mnemo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheMetrics(t *testing.T) {
+	cache := newCache[int]()
+	// a small feed that is never read
+	cache.raw.feed = make(chan map[time.Time]map[CacheKey]Item[int], 1)
+	cache.SetReducer(cache.DefaultReducer)
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Set("c", 3)
+	cache.Get("a")
+	cache.Get("missing")
+	cache.mu.Lock()
+	cache.remove("b", sourceExpiry)
+	cache.remove("c", sourceRemote)
+	cache.mu.Unlock()
+
+	waitFor(t, time.Second, func() bool {
+		m := cache.Metrics()
+		return m.Reductions > 0 && m.RawFeedDropped > 0
+	})
+	m := cache.Metrics()
+	if m.Hits != 1 || m.Misses != 1 || m.Items != 1 {
+		t.Errorf("unexpected lookups %+v", m)
+	}
+	if m.Expirations != 1 || m.Evictions != 1 {
+		t.Errorf("unexpected removals %+v", m)
+	}
+	if m.HistorySize == 0 || m.RawFeedDepth != 1 || m.ReducerFeedDepth == 0 {
+		t.Errorf("unexpected history and feeds %+v", m)
+	}
+}
+
+func TestCommandMetrics(t *testing.T) {
+	c := NewCommands()
+	c.Register("ok", func(ctx context.Context, args any) (any, error) {
+		return nil, nil
+	})
+	c.Register("fail", func(ctx context.Context, args any) (any, error) {
+		return nil, errors.New("failed")
+	})
+	c.Execute(context.Background(), "ok", nil)
+	c.Execute(context.Background(), "ok", nil)
+	c.Execute(context.Background(), "fail", nil)
+	c.Execute(context.Background(), "missing", nil)
+
+	m := c.Metrics()
+	if len(m) != 2 || m["ok"].Executions != 2 || m["ok"].Errors != 0 || m["fail"].Errors != 1 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	var buf bytes.Buffer
+	err := WritePrometheus(&buf, []Metric{
+		{Name: "req_seconds_sum", Help: "Request time.", Type: Summary, Value: 1.5},
+		{Name: "up", Help: "Up.", Type: Gauge, Value: 1},
+		{Name: "req_seconds_count", Help: "Request time.", Type: Summary, Value: 3},
+		{Name: "hits_total", Type: Counter, Labels: map[string]string{"path": `a"b`, "code": "200"}, Value: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP req_seconds Request time.
+# TYPE req_seconds summary
+req_seconds_sum 1.5
+req_seconds_count 3
+# HELP up Up.
+# TYPE up gauge
+up 1
+# TYPE hits_total counter
+hits_total{code="200",path="a\"b"} 2
+`
+	if buf.String() != want {
+		t.Errorf("unexpected exposition\n%s", buf.String())
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	var key StoreKey = "metrics_store"
+	store, _ := NewStore(key)
+	cache, _ := NewCache[int](key, "numbers")
+	cache.Set("a", 1)
+	cache.Get("a")
+	store.Commands().Register("ping", func(ctx context.Context, args any) (any, error) {
+		return "pong", nil
+	})
+	store.Commands().Execute(context.Background(), "ping", nil)
+
+	m := New().WithServer("metrics", WithPort(8214), WithSilence())
+	m.WithStores(key)
+	m.Server().RegisterCollector(CollectorFunc(func() []Metric {
+		return []Metric{{Name: "app_jobs", Type: Gauge, Value: 7}}
+	}))
+	m.Server().Publish("hello")
+
+	rec := httptest.NewRecorder()
+	m.Server().HandleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		`mnemo_cache_hits_total{cache="numbers",store="metrics_store"} 1`,
+		`mnemo_cache_items{cache="numbers",store="metrics_store"} 1`,
+		`mnemo_command_seconds_count{command="ping",store="metrics_store"} 1`,
+		`mnemo_server_connections 0`,
+		`mnemo_server_publish_seconds_count 1`,
+		`app_jobs 7`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in metrics\n%s", line, body)
+		}
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestGatherConcurrentStores(t *testing.T) {
+	m := New().WithServer("metrics_stores", WithPort(8225), WithSilence())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			key := StoreKey(fmt.Sprintf("metrics_stores_%d", i))
+			m.WithStores(key)
+			m.DetachStore(key)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		m.Server().Gather()
+	}
+	<-done
+}
@@ -0,0 +1,161 @@
+package mnemo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// Middleware wraps the handler of the command with key.
+	Middleware func(key CommandKey, next CommandHandler) CommandHandler
+	// commandPanic is a panic raised by a command handler.
+	commandPanic struct {
+		value any
+		stack []byte
+	}
+	// bucket is a token bucket limiting the rate of a command.
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+// Use wraps every command of the collection with middleware, which runs in the
+// order given after any middleware already in use.
+func (c *Commands) Use(mw ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// copy so running commands keep the middleware they started with
+	c.middleware = append(append([]Middleware{}, c.middleware...), mw...)
+}
+
+// Recover recovers panics in commands and returns them as errors.
+func Recover() Middleware {
+	return func(key CommandKey, next CommandHandler) CommandHandler {
+		return func(ctx context.Context, args any) (result any, err error) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				stack := ""
+				if cp, ok := p.(*commandPanic); ok {
+					p, stack = cp.value, string(cp.stack)
+				}
+				e := NewError[Commands](fmt.Sprintf("command '%v' panicked: %v", key, p)).
+					WithStatus(http.StatusInternalServerError)
+				NewError[Commands](fmt.Sprintf("%v\n%s", e.Err, stack)).Log()
+				result, err = nil, e
+			}()
+			return next(ctx, args)
+		}
+	}
+}
+
+// Logging logs every execution of a command with its duration and any error.
+// The package logger is used if l is nil.
+func Logging(l Logger) Middleware {
+	if l == nil {
+		l = logger
+	}
+	return func(key CommandKey, next CommandHandler) CommandHandler {
+		return func(ctx context.Context, args any) (any, error) {
+			start := time.Now()
+			result, err := next(ctx, args)
+			if err != nil {
+				l.Warn(fmt.Sprintf("command '%v' failed after %v: %v", key, time.Since(start), err))
+				return result, err
+			}
+			l.Info(fmt.Sprintf("command '%v' succeeded in %v", key, time.Since(start)))
+			return result, err
+		}
+	}
+}
+
+// Timing calls fn with the duration and error of every execution of a command.
+func Timing(fn func(key CommandKey, d time.Duration, err error)) Middleware {
+	return func(key CommandKey, next CommandHandler) CommandHandler {
+		return func(ctx context.Context, args any) (any, error) {
+			start := time.Now()
+			result, err := next(ctx, args)
+			fn(key, time.Since(start), err)
+			return result, err
+		}
+	}
+}
+
+// Authorize runs a command only if fn returns nil for it.
+func Authorize(fn func(ctx context.Context, key CommandKey, args any) error) Middleware {
+	return func(key CommandKey, next CommandHandler) CommandHandler {
+		return func(ctx context.Context, args any) (any, error) {
+			if err := fn(ctx, key, args); err != nil {
+				return nil, NewError[Commands](fmt.Sprintf("command '%v' is not authorized: %v", key, err)).
+					WithStatus(http.StatusForbidden)
+			}
+			return next(ctx, args)
+		}
+	}
+}
+
+// RateLimit limits each command to rate executions per second with bursts of
+// up to burst executions. Executions over the limit fail without running.
+func RateLimit(rate float64, burst int) Middleware {
+	var mu sync.Mutex
+	buckets := make(map[CommandKey]*bucket)
+	allow := func(key CommandKey) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now()
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{tokens: float64(burst), last: now}
+			buckets[key] = b
+		}
+		b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+		if b.tokens < 1 {
+			return false
+		}
+		b.tokens--
+		return true
+	}
+	return func(key CommandKey, next CommandHandler) CommandHandler {
+		return func(ctx context.Context, args any) (any, error) {
+			if !allow(key) {
+				return nil, NewError[Commands](fmt.Sprintf("command '%v' is rate limited", key)).
+					WithStatus(http.StatusTooManyRequests)
+			}
+			return next(ctx, args)
+		}
+	}
+}
+
+// Retry runs a failed command again up to attempts times in total, doubling
+// backoff between attempts. Commands that were canceled or timed out are not retried.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	return func(key CommandKey, next CommandHandler) CommandHandler {
+		return func(ctx context.Context, args any) (any, error) {
+			result, err := next(ctx, args)
+			delay := backoff
+			for i := 1; i < attempts && err != nil; i++ {
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					break
+				}
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return result, err
+				}
+				delay *= 2
+				result, err = next(ctx, args)
+			}
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package mnemo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *testLogger) log(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, msg)
+}
+
+func (l *testLogger) Info(msg string)  { l.log(msg) }
+func (l *testLogger) Debug(msg string) { l.log(msg) }
+func (l *testLogger) Warn(msg string)  { l.log(msg) }
+func (l *testLogger) Error(msg string) { l.log(msg) }
+func (l *testLogger) Fatal(msg string) { l.log(msg) }
+
+func TestRecover(t *testing.T) {
+	c := NewCommands()
+	c.Assign(map[CommandKey]func(){
+		"panic": func() { panic("boom") },
+	})
+	_, err := c.Execute(context.Background(), "panic", nil)
+	if e, ok := IsErrorType[Commands](err); !ok || !strings.Contains(e.Error(), "boom") {
+		t.Fatalf("expected panic to be returned as an error; got %v", err)
+	}
+
+	// the collection is not left locked
+	c.Register("ok", func(ctx context.Context, args any) (any, error) {
+		return "ok", nil
+	})
+	if result, _ := c.Execute(context.Background(), "ok", nil); result != "ok" {
+		t.Errorf("expected command to run after a panic; got %v", result)
+	}
+	id, _ := c.Submit("panic", nil)
+	if job, _ := c.Wait(context.Background(), id); job.Status != JobFailed {
+		t.Errorf("expected panicking job to fail; got %+v", job)
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(key CommandKey, next CommandHandler) CommandHandler {
+			return func(ctx context.Context, args any) (any, error) {
+				order = append(order, name)
+				return next(ctx, args)
+			}
+		}
+	}
+	c := NewCommands()
+	c.Use(trace("store 1"), trace("store 2"))
+	c.Register("cmd", func(ctx context.Context, args any) (any, error) {
+		order = append(order, "handler")
+		return nil, nil
+	}, WithMiddleware(trace("command")))
+	c.Execute(context.Background(), "cmd", nil)
+	if strings.Join(order, ",") != "store 1,store 2,command,handler" {
+		t.Errorf("unexpected middleware order %v", order)
+	}
+}
+
+func TestLoggingAndTiming(t *testing.T) {
+	l := &testLogger{}
+	var timed []time.Duration
+	c := NewCommands()
+	c.Use(Logging(l), Timing(func(key CommandKey, d time.Duration, err error) {
+		timed = append(timed, d)
+	}))
+	c.Register("fail", func(ctx context.Context, args any) (any, error) {
+		time.Sleep(5 * time.Millisecond)
+		return nil, errors.New("failed")
+	})
+	c.Execute(context.Background(), "fail", nil)
+	if len(l.logs) != 1 || !strings.Contains(l.logs[0], "command 'fail' failed") {
+		t.Errorf("unexpected logs %v", l.logs)
+	}
+	if len(timed) != 1 || timed[0] < 5*time.Millisecond {
+		t.Errorf("unexpected timings %v", timed)
+	}
+}
+
+type roleKey struct{}
+
+func TestAuthorize(t *testing.T) {
+	c := NewCommands()
+	c.Register("admin", func(ctx context.Context, args any) (any, error) {
+		return "done", nil
+	}, WithMiddleware(Authorize(func(ctx context.Context, key CommandKey, args any) error {
+		if ctx.Value(roleKey{}) != "admin" {
+			return errors.New("admins only")
+		}
+		return nil
+	})))
+	_, err := c.Execute(context.Background(), "admin", nil)
+	if e, ok := IsErrorType[Commands](err); !ok || e.Status != 403 {
+		t.Errorf("expected forbidden error; got %v", err)
+	}
+	ctx := context.WithValue(context.Background(), roleKey{}, "admin")
+	if result, err := c.Execute(ctx, "admin", nil); err != nil || result != "done" {
+		t.Errorf("expected authorized command to run; got %v, %v", result, err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	c := NewCommands()
+	c.Use(RateLimit(50, 2))
+	for _, key := range []CommandKey{"a", "b"} {
+		c.Register(key, func(ctx context.Context, args any) (any, error) {
+			return nil, nil
+		})
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Execute(context.Background(), "a", nil); err != nil {
+			t.Fatalf("expected burst to be allowed; got %v", err)
+		}
+	}
+	if _, err := c.Execute(context.Background(), "a", nil); err == nil {
+		t.Error("expected execution over the limit to fail")
+	}
+	if _, err := c.Execute(context.Background(), "b", nil); err != nil {
+		t.Errorf("expected commands to be limited separately; got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := c.Execute(context.Background(), "a", nil); err != nil {
+		t.Errorf("expected tokens to refill; got %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	c := NewCommands()
+	attempts := 0
+	c.Register("flaky", func(ctx context.Context, args any) (any, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errors.New("unavailable")
+		}
+		return attempts, nil
+	}, WithMiddleware(Retry(3, time.Millisecond)))
+	if result, err := c.Execute(context.Background(), "flaky", nil); err != nil || result != 3 {
+		t.Errorf("expected third attempt to succeed; got %v, %v", result, err)
+	}
+
+	var slow atomic.Int64
+	c.Register("slow", func(ctx context.Context, args any) (any, error) {
+		slow.Add(1)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, WithMiddleware(Retry(3, time.Millisecond)), WithCommandTimeout(10*time.Millisecond))
+	if _, err := c.Execute(context.Background(), "slow", nil); !errors.Is(err, context.DeadlineExceeded) || slow.Load() != 1 {
+		t.Errorf("expected timed out command not to be retried; got %d attempts, %v", slow.Load(), err)
+	}
+}
@@ -6,10 +6,12 @@ import "sync"
 type (
 	// Mnemo is the main struct for the Mnemo package.
 	Mnemo struct {
-		mu     sync.Mutex
-		server *Server
-		logger Logger
-		stores map[StoreKey]bool
+		mu           sync.Mutex
+		server       *Server
+		logger       Logger
+		stores       map[StoreKey]bool
+		invalidation *InvalidationBus
+		partitions   map[string]partition
 	}
 	Opt[T any] func(t *T)
 )
@@ -44,6 +46,8 @@ func (m *Mnemo) Server() *Server {
 
 // WithStore adds one or more stores to the Mnemo instance.
 func (m *Mnemo) WithStores(keys ...StoreKey) *Mnemo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for _, k := range keys {
 		m.stores[k] = true
 	}
@@ -76,10 +80,30 @@ func (m *Mnemo) UseStore(key StoreKey) (*Store, error) {
 	return s, nil
 }
 
+// hasStore reports whether a store has been added to the Mnemo instance.
+func (m *Mnemo) hasStore(key StoreKey) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stores[key]
+}
+
+// storeKeys returns the keys of the stores added to the Mnemo instance.
+func (m *Mnemo) storeKeys() []StoreKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]StoreKey, 0, len(m.stores))
+	for k := range m.stores {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 func (m *Mnemo) StoreKeys() map[StoreKey]bool {
 	return m.stores
 }
 
 func (m *Mnemo) DetachStore(key StoreKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.stores, key)
 }
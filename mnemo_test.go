@@ -1,6 +1,7 @@
 package mnemo
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
@@ -30,6 +31,15 @@ func Example() {
 		},
 	})
 
+	// Commands may also take arguments and return results
+	cmd.Register("example_sum", Handler(func(ctx context.Context, args []int) (int, error) {
+		sum := 0
+		for _, n := range args {
+			sum += n
+		}
+		return sum, nil
+	}))
+
 	// Create a type to cache
 	type Message struct {
 		Msg string
@@ -61,7 +71,9 @@ func Example() {
 
 	// Access and execute commands from anywhere
 	myCmds := myStore.Commands()
-	myCmds.Execute(ExampleCmdKey)
+	myCmds.Execute(context.Background(), ExampleCmdKey, nil)
+	sum, _ := myCmds.Execute(context.Background(), "example_sum", []int{1, 2})
+	fmt.Println(sum)
 
 	// List commands if needed
 	_ = myCmds.List()
@@ -81,6 +93,7 @@ func Example() {
 
 	// Output:
 	// I'm a command!
+	// 3
 	// Hello, Mnemo! With a reducer!
 }
 
@@ -0,0 +1,498 @@
+package mnemo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	partitionGet    partitionOp = "get"
+	partitionCache  partitionOp = "cache"
+	partitionUpdate partitionOp = "update"
+	partitionDelete partitionOp = "delete"
+	// partitionPut stores an item handed off during rebalancing.
+	partitionPut partitionOp = "put"
+)
+
+type (
+	// PartitionedCache spreads a single logical cache across several nodes.
+	//
+	// Keys are assigned to nodes by a consistent hash ring. Operations on keys
+	// owned by another node are forwarded to that node's server. Each node keeps
+	// the keys it owns in a local Cache.
+	PartitionedCache[T any] struct {
+		mu     sync.Mutex
+		name   string
+		self   Node
+		local  *Cache[T]
+		ring   *HashRing
+		nodes  map[string]Node
+		client *http.Client
+		header http.Header
+	}
+	// PartitionConfig configures a partitioned cache.
+	PartitionConfig struct {
+		// VirtualNodes is the number of points each node occupies on the hash ring.
+		VirtualNodes int
+		// Timeout is the timeout for requests forwarded to other nodes.
+		Timeout time.Duration
+		// Header is sent with requests forwarded to other nodes.
+		Header http.Header
+	}
+	// Node is a member of a partitioned cache.
+	Node struct {
+		// ID uniquely identifies the node on the ring.
+		ID string `json:"id"`
+		// URL is the base http url of the node's server, e.g. 'http://localhost:8080/node'.
+		URL string `json:"url"`
+	}
+	// partition is implemented by every PartitionedCache so the server can
+	// serve forwarded requests for caches of any type.
+	partition interface {
+		serve(req partitionRequest) partitionResponse
+	}
+	partitionOp string
+	// partitionRequest is forwarded to the node that owns a key.
+	partitionRequest struct {
+		Name string          `json:"name"`
+		Op   partitionOp     `json:"op"`
+		Key  wireKey         `json:"key"`
+		Data json.RawMessage `json:"data,omitempty"`
+	}
+	// partitionResponse is returned by the node that owns a key.
+	partitionResponse struct {
+		OK    bool            `json:"ok"`
+		Item  json.RawMessage `json:"item,omitempty"`
+		Error string          `json:"error,omitempty"`
+	}
+)
+
+// WithVirtualNodes sets the number of points each node occupies on the hash ring.
+func WithVirtualNodes(n int) Opt[PartitionConfig] {
+	return func(c *PartitionConfig) {
+		c.VirtualNodes = n
+	}
+}
+
+// WithForwardTimeout sets the timeout for requests forwarded to other nodes.
+func WithForwardTimeout(d time.Duration) Opt[PartitionConfig] {
+	return func(c *PartitionConfig) {
+		c.Timeout = d
+	}
+}
+
+// WithForwardHeader sets the header sent with requests forwarded to other nodes,
+// such as the credentials required by their servers' authenticators.
+func WithForwardHeader(header http.Header) Opt[PartitionConfig] {
+	return func(c *PartitionConfig) {
+		c.Header = header
+	}
+}
+
+// NewPartitionedCache creates a partitioned cache named name, backed by local,
+// with self as its only node.
+//
+// The Mnemo instance must have a server created WithPartitioning so other nodes
+// can forward requests to it.
+// Every node of the same logical cache must use the same name.
+func NewPartitionedCache[T any](
+	m *Mnemo,
+	name string,
+	local *Cache[T],
+	self Node,
+	opts ...Opt[PartitionConfig],
+) (*PartitionedCache[T], error) {
+	cfg := PartitionConfig{
+		VirtualNodes: 64,
+		Timeout:      10 * time.Second,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	p := &PartitionedCache[T]{
+		name:   name,
+		self:   self,
+		local:  local,
+		ring:   NewHashRing(cfg.VirtualNodes),
+		nodes:  map[string]Node{self.ID: self},
+		client: &http.Client{Timeout: cfg.Timeout},
+		header: cfg.Header,
+	}
+	p.ring.Add(self.ID)
+	if err := m.addPartition(name, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// addPartition registers a partitioned cache with the Mnemo instance's server.
+func (m *Mnemo) addPartition(name string, p partition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.server == nil || !m.server.cfg.Partitioning {
+		return NewError[Mnemo]("partitioned caches require a server created WithPartitioning")
+	}
+	if m.partitions == nil {
+		m.partitions = make(map[string]partition)
+	}
+	if _, ok := m.partitions[name]; ok {
+		return NewError[Mnemo](fmt.Sprintf("partitioned cache with name '%s' already exists", name))
+	}
+	m.partitions[name] = p
+	return nil
+}
+
+// partition returns a registered partitioned cache by name.
+func (m *Mnemo) partition(name string) (partition, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.partitions[name]
+	return p, ok
+}
+
+// Local returns the cache holding the keys owned by this node.
+func (p *PartitionedCache[T]) Local() *Cache[T] {
+	return p.local
+}
+
+// Nodes returns the members of the partitioned cache.
+func (p *PartitionedCache[T]) Nodes() []Node {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	nodes := make([]Node, 0, len(p.nodes))
+	for _, id := range p.ring.Nodes() {
+		nodes = append(nodes, p.nodes[id])
+	}
+	return nodes
+}
+
+// Owner returns the node that owns key.
+func (p *PartitionedCache[T]) Owner(key CacheKey) (Node, error) {
+	wk, err := encodeKey(key)
+	if err != nil {
+		return Node{}, err
+	}
+	return p.owner(wk), nil
+}
+
+func (p *PartitionedCache[T]) owner(key wireKey) Node {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, ok := p.ring.Owner(ringKey(key))
+	if !ok {
+		return p.self
+	}
+	return p.nodes[id]
+}
+
+// AddNode adds a node to the ring and hands off local keys the node now owns.
+//
+// Every member must add the node for requests to be routed consistently.
+func (p *PartitionedCache[T]) AddNode(n Node) error {
+	p.mu.Lock()
+	p.nodes[n.ID] = n
+	p.ring.Add(n.ID)
+	p.mu.Unlock()
+	return p.rebalance()
+}
+
+// RemoveNode removes a node from the ring.
+//
+// Keys held by the removed node are not recovered; the node should call Leave
+// before it is removed from the other members.
+func (p *PartitionedCache[T]) RemoveNode(id string) error {
+	if id == p.self.ID {
+		return p.Leave()
+	}
+	p.mu.Lock()
+	delete(p.nodes, id)
+	p.ring.Remove(id)
+	p.mu.Unlock()
+	return p.rebalance()
+}
+
+// Leave removes this node from its own ring and hands off every local key
+// to the remaining nodes.
+func (p *PartitionedCache[T]) Leave() error {
+	p.mu.Lock()
+	if len(p.nodes) == 1 {
+		p.mu.Unlock()
+		return NewError[PartitionedCache[T]]("cannot leave a ring with no other nodes")
+	}
+	p.ring.Remove(p.self.ID)
+	p.mu.Unlock()
+	return p.rebalance()
+}
+
+// rebalance forwards every local key owned by another node to its owner.
+//
+// A key written while it is handed off is kept and reported as an error, so it
+// is handed off again by the next rebalance.
+func (p *PartitionedCache[T]) rebalance() error {
+	var errs []error
+	for key, item := range p.local.GetAll() {
+		wk, err := encodeKey(key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		owner := p.owner(wk)
+		if owner.ID == p.self.ID {
+			continue
+		}
+		b, err := json.Marshal(item)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res, err := p.forward(owner, partitionRequest{Op: partitionPut, Key: wk, Data: b})
+		if err == nil && !res.OK {
+			err = fmt.Errorf("%s", res.Error)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := p.removeHandedOff(key, item); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return NewError[PartitionedCache[T]](fmt.Sprintf("could not hand off %d keys: %v", len(errs), errs[0]))
+	}
+	return nil
+}
+
+// removeHandedOff removes a key handed off to its owner, unless it was written
+// since it was handed off.
+func (p *PartitionedCache[T]) removeHandedOff(key CacheKey, item Item[T]) error {
+	p.local.mu.Lock()
+	defer p.local.mu.Unlock()
+	cur, ok := p.local.raw.caches[key]
+	if !ok {
+		return nil
+	}
+	if cur.Version != item.Version || !cur.UpdatedAt.Equal(item.UpdatedAt) {
+		return NewError[PartitionedCache[T]](fmt.Sprintf("key '%v' was written while it was handed off", key))
+	}
+	_, err := p.local.remove(key, sourceRemote)
+	return err
+}
+
+// Get returns an item by key from the node that owns it.
+func (p *PartitionedCache[T]) Get(key CacheKey) (Item[T], bool, error) {
+	res, err := p.do(partitionGet, key, nil)
+	if err != nil {
+		return *new(Item[T]), false, err
+	}
+	if res.Error != "" {
+		return *new(Item[T]), false, NewError[PartitionedCache[T]](res.Error)
+	}
+	if !res.OK {
+		return *new(Item[T]), false, nil
+	}
+	var item Item[T]
+	if err := json.Unmarshal(res.Item, &item); err != nil {
+		return *new(Item[T]), false, NewError[PartitionedCache[T]](err.Error())
+	}
+	return item, true, nil
+}
+
+// Cache caches data by key on the node that owns it.
+func (p *PartitionedCache[T]) Cache(key CacheKey, data *T) error {
+	res, err := p.do(partitionCache, key, data)
+	if err != nil {
+		return err
+	}
+	if !res.OK {
+		return NewError[PartitionedCache[T]](res.Error)
+	}
+	return nil
+}
+
+// Update updates an item on the node that owns it. It returns false if the item
+// does not exist, or an error if the owner could not update it.
+func (p *PartitionedCache[T]) Update(key CacheKey, update T) (bool, error) {
+	res, err := p.do(partitionUpdate, key, update)
+	if err != nil {
+		return false, err
+	}
+	if res.Error != "" {
+		return false, NewError[PartitionedCache[T]](res.Error)
+	}
+	return res.OK, nil
+}
+
+// Delete deletes an item on the node that owns it.
+func (p *PartitionedCache[T]) Delete(key CacheKey) error {
+	res, err := p.do(partitionDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	if !res.OK {
+		return NewError[PartitionedCache[T]](res.Error)
+	}
+	return nil
+}
+
+// do runs an operation locally or forwards it to the node that owns key.
+func (p *PartitionedCache[T]) do(op partitionOp, key CacheKey, data any) (partitionResponse, error) {
+	wk, err := encodeKey(key)
+	if err != nil {
+		return partitionResponse{}, err
+	}
+	req := partitionRequest{Name: p.name, Op: op, Key: wk}
+	if data != nil {
+		if req.Data, err = json.Marshal(data); err != nil {
+			return partitionResponse{}, NewError[PartitionedCache[T]](err.Error())
+		}
+	}
+	owner := p.owner(wk)
+	if owner.ID == p.self.ID {
+		return p.serve(req), nil
+	}
+	return p.forward(owner, req)
+}
+
+// forward sends a request to another node's server.
+func (p *PartitionedCache[T]) forward(n Node, req partitionRequest) (partitionResponse, error) {
+	req.Name = p.name
+	body, err := json.Marshal(req)
+	if err != nil {
+		return partitionResponse{}, NewError[PartitionedCache[T]](err.Error())
+	}
+	r, err := http.NewRequest(http.MethodPost, n.URL+"/partition", bytes.NewReader(body))
+	if err != nil {
+		return partitionResponse{}, NewError[PartitionedCache[T]](err.Error())
+	}
+	for k, v := range p.header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(r)
+	if err != nil {
+		return partitionResponse{}, NewError[PartitionedCache[T]](err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return partitionResponse{}, NewError[PartitionedCache[T]](
+			fmt.Sprintf("node '%s' responded with status %d", n.ID, resp.StatusCode),
+		).WithStatus(resp.StatusCode)
+	}
+	var res partitionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return partitionResponse{}, NewError[PartitionedCache[T]](
+			fmt.Sprintf("invalid response from node '%s': %v", n.ID, err),
+		)
+	}
+	return res, nil
+}
+
+// serve runs a request against the local cache.
+func (p *PartitionedCache[T]) serve(req partitionRequest) partitionResponse {
+	key, err := decodeKey(req.Key)
+	if err != nil {
+		return partitionResponse{Error: err.Error()}
+	}
+	switch req.Op {
+	case partitionGet:
+		item, ok := p.local.Get(key)
+		if !ok {
+			return partitionResponse{}
+		}
+		b, err := json.Marshal(item)
+		if err != nil {
+			return partitionResponse{Error: err.Error()}
+		}
+		return partitionResponse{OK: true, Item: b}
+	case partitionCache:
+		var data T
+		if err := json.Unmarshal(req.Data, &data); err != nil {
+			return partitionResponse{Error: err.Error()}
+		}
+		if err := p.local.Cache(key, &data); err != nil {
+			return partitionResponse{Error: err.Error()}
+		}
+		return partitionResponse{OK: true}
+	case partitionUpdate:
+		var data T
+		if err := json.Unmarshal(req.Data, &data); err != nil {
+			return partitionResponse{Error: err.Error()}
+		}
+		p.local.mu.Lock()
+		defer p.local.mu.Unlock()
+		prev, ok := p.local.raw.caches[key]
+		if !ok {
+			return partitionResponse{}
+		}
+		if _, err := p.local.replace(key, prev, &data, sourceLocal); err != nil {
+			return partitionResponse{Error: err.Error()}
+		}
+		return partitionResponse{OK: true}
+	case partitionDelete:
+		if err := p.local.Delete(key); err != nil {
+			return partitionResponse{Error: err.Error()}
+		}
+		return partitionResponse{OK: true}
+	case partitionPut:
+		var item Item[T]
+		if err := json.Unmarshal(req.Data, &item); err != nil {
+			return partitionResponse{Error: err.Error()}
+		}
+		p.local.mu.Lock()
+		defer p.local.mu.Unlock()
+		// a handoff that arrives late must not overwrite a newer write the owner accepted
+		if prev, ok := p.local.raw.caches[key]; ok && !newerItem(item, *prev) {
+			return partitionResponse{OK: true}
+		}
+		if err := p.local.put(key, item, sourceRemote); err != nil {
+			return partitionResponse{Error: err.Error()}
+		}
+		return partitionResponse{OK: true}
+	}
+	return partitionResponse{Error: fmt.Sprintf("unknown operation '%s'", req.Op)}
+}
+
+// HandlePartition serves requests forwarded by other nodes of a partitioned cache.
+//
+// The route is only served by servers created WithPartitioning.
+func (s *Server) HandlePartition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.mnemo == nil {
+		http.Error(w, "server has no mnemo instance", http.StatusServiceUnavailable)
+		return
+	}
+	var req partitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p, ok := s.mnemo.partition(req.Name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no partitioned cache with name '%s'", req.Name), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.serve(req))
+}
+
+// newerItem reports whether a was written after b. Versions are only compared
+// when both were written at the same time, as nodes version keys independently.
+func newerItem[T any](a, b Item[T]) bool {
+	if !a.UpdatedAt.Equal(b.UpdatedAt) {
+		return a.UpdatedAt.After(b.UpdatedAt)
+	}
+	return a.Version > b.Version
+}
+
+// ringKey is the string hashed onto the ring for a key.
+func ringKey(key wireKey) string {
+	return key.Kind + ":" + string(key.Value)
+}
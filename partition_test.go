@@ -0,0 +1,273 @@
+package mnemo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHashRing(t *testing.T) {
+	r := NewHashRing(64)
+	if _, ok := r.Owner("key"); ok {
+		t.Error("expected empty ring to have no owner")
+	}
+	r.Add("a", "b", "c")
+	counts := map[string]int{}
+	owners := map[string]string{}
+	for i := 0; i < 3000; i++ {
+		k := fmt.Sprint(i)
+		owner, _ := r.Owner(k)
+		counts[owner]++
+		owners[k] = owner
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if counts[id] < 500 {
+			t.Errorf("expected keys to be spread across nodes; got %v", counts)
+		}
+	}
+
+	// only keys owned by the removed node should move
+	r.Remove("c")
+	for k, prev := range owners {
+		owner, _ := r.Owner(k)
+		if prev != "c" && owner != prev {
+			t.Fatalf("key %s moved from %s to %s", k, prev, owner)
+		}
+		if owner == "c" {
+			t.Fatalf("key %s still owned by removed node", k)
+		}
+	}
+}
+
+func TestPartitionedCache(t *testing.T) {
+	type node struct {
+		cache *PartitionedCache[int]
+		self  Node
+	}
+	newNode := func(id string, port int) node {
+		store := StoreKey("partition_" + id)
+		m := New().WithServer("partition_"+id, WithPort(port), WithSilence(), WithPartitioning())
+		NewStore(store)
+		m.WithStores(store)
+		local, err := NewCache[int](store, "counts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		self := Node{ID: id, URL: m.Server().HTTPURL()}
+		pc, err := NewPartitionedCache(m, "counts", local, self)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Server().ListenAndServe()
+		t.Cleanup(func() { m.Server().Shutdown() })
+		return node{cache: pc, self: self}
+	}
+	a, b, c := newNode("a", 8205), newNode("b", 8206), newNode("c", 8207)
+	for _, n := range []node{a, b, c} {
+		for _, peer := range []node{a, b, c} {
+			if n.self != peer.self {
+				n.cache.AddNode(peer.self)
+			}
+		}
+	}
+
+	const total = 60
+	for i := 0; i < total; i++ {
+		v := i
+		waitForNoError(t, func() error { return a.cache.Cache(i, &v) })
+	}
+	held := 0
+	for _, n := range []node{a, b, c} {
+		local := n.cache.Local().GetAll()
+		held += len(local)
+		for k := range local {
+			owner, _ := n.cache.Owner(k)
+			if owner.ID != n.self.ID {
+				t.Errorf("node %s holds key %v owned by %s", n.self.ID, k, owner.ID)
+			}
+		}
+	}
+	if held != total {
+		t.Errorf("expected %d keys across nodes; got %d", total, held)
+	}
+
+	if ok, err := b.cache.Update(7, 70); !ok || err != nil {
+		t.Errorf("expected forwarded update to succeed; got %v, %v", ok, err)
+	}
+	item, ok, err := c.cache.Get(7)
+	if !ok || err != nil || *item.Data != 70 {
+		t.Errorf("expected forwarded get to return updated item; got %v, %v", ok, err)
+	}
+
+	// c leaves and hands its keys off before the others remove it
+	if err := c.cache.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	a.cache.RemoveNode("c")
+	b.cache.RemoveNode("c")
+	if len(c.cache.Local().GetAll()) != 0 {
+		t.Error("expected leaving node to hand off all keys")
+	}
+	for i := 0; i < total; i++ {
+		if _, ok, err := a.cache.Get(i); !ok || err != nil {
+			t.Fatalf("key %d lost after node left: %v", i, err)
+		}
+	}
+
+	if err := a.cache.Delete(7); err != nil {
+		t.Error(err)
+	}
+	if _, ok, _ := b.cache.Get(7); ok {
+		t.Error("expected forwarded delete to remove key")
+	}
+}
+
+func TestPartitionedCacheAuthentication(t *testing.T) {
+	authenticate := WithAuthenticator(func(r *http.Request) (string, error) {
+		if r.Header.Get("Authorization") != "secret" {
+			return "", errors.New("missing token")
+		}
+		return "node", nil
+	})
+	newNode := func(id string, port int, opts ...Opt[PartitionConfig]) *PartitionedCache[int] {
+		store := StoreKey("partition_auth_" + id)
+		m := New().WithServer("partition_auth_"+id, WithPort(port), WithSilence(), WithPartitioning(), authenticate)
+		NewStore(store)
+		m.WithStores(store)
+		local, _ := NewCache[int](store, "counts")
+		pc, err := NewPartitionedCache(m, "auth_counts", local, Node{ID: id, URL: m.Server().HTTPURL()}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Server().ListenAndServe()
+		t.Cleanup(func() { m.Server().Shutdown() })
+		return pc
+	}
+	a := newNode("a", 8217, WithForwardHeader(http.Header{"Authorization": {"secret"}}))
+	b := newNode("b", 8218)
+	a.AddNode(b.self)
+	b.AddNode(a.self)
+
+	// find a key owned by b so a must forward it
+	key := 0
+	for owner, _ := a.Owner(key); owner.ID != "b"; owner, _ = a.Owner(key) {
+		key++
+	}
+	v := 1
+	waitForNoError(t, func() error { return a.Cache(key, &v) })
+	if _, ok := b.Local().Get(key); !ok {
+		t.Error("expected forwarded request with credentials to be served")
+	}
+	// b forwards without credentials
+	for owner, _ := b.Owner(key); owner.ID != "a"; owner, _ = b.Owner(key) {
+		key++
+	}
+	err := b.Cache(key, &v)
+	if e, ok := IsErrorType[PartitionedCache[int]](err); !ok || e.Status != http.StatusUnauthorized {
+		t.Errorf("expected forwarded request without credentials to be rejected; got %v", err)
+	}
+}
+
+func TestPartitionedCacheErrors(t *testing.T) {
+	var key StoreKey = "partition_errors"
+	m := New().WithServer("partition_errors", WithPort(8219), WithSilence(), WithPartitioning())
+	NewStore(key)
+	m.WithStores(key)
+	local, _ := NewCache[int](key, "counts")
+	p, err := NewPartitionedCache(m, "error_counts", local, Node{ID: "a", URL: m.Server().HTTPURL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewMemorySink[int]()
+	local.SetSink(sink)
+	defer local.CloseSink()
+	one := 1
+	p.Cache("one", &one)
+
+	if ok, err := p.Update("missing", 2); ok || err != nil {
+		t.Errorf("expected missing key not to be updated; got %v, %v", ok, err)
+	}
+	sink.SetError(errors.New("unavailable"))
+	if ok, err := p.Update("one", 2); ok || err == nil {
+		t.Errorf("expected owner's failure to be returned; got %v, %v", ok, err)
+	}
+
+	// a handoff that breaks a unique index is not acknowledged
+	local.AddIndex("value", func(n int) any { return n }, WithUniqueIndex())
+	wk, _ := encodeKey("two")
+	b, _ := json.Marshal(Item[int]{Version: 1, Data: &one})
+	if res := p.serve(partitionRequest{Op: partitionPut, Key: wk, Data: b}); res.OK || res.Error == "" {
+		t.Errorf("expected failed handoff to return its error; got %+v", res)
+	}
+}
+
+func TestPartitionedCacheHandoff(t *testing.T) {
+	var key StoreKey = "partition_handoff"
+	m := New().WithServer("partition_handoff", WithPort(8224), WithSilence(), WithPartitioning())
+	NewStore(key)
+	m.WithStores(key)
+	local, _ := NewCache[int](key, "counts")
+	p, err := NewPartitionedCache(m, "handoff_counts", local, Node{ID: "a", URL: m.Server().HTTPURL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a late handoff does not overwrite a newer write
+	stale, newer := 1, 2
+	local.Cache("one", &newer)
+	wk, _ := encodeKey("one")
+	b, _ := json.Marshal(Item[int]{Version: 5, UpdatedAt: time.Now().Add(-time.Minute), Data: &stale})
+	if res := p.serve(partitionRequest{Op: partitionPut, Key: wk, Data: b}); !res.OK {
+		t.Errorf("expected stale handoff to be acknowledged; got %+v", res)
+	}
+	if item, _ := local.Get("one"); *item.Data != newer {
+		t.Errorf("expected newer write to be kept; got %d", *item.Data)
+	}
+
+	// a key written after it was handed off is kept
+	handedOff, _ := local.Get("one")
+	local.Update("one", 3)
+	if err := p.removeHandedOff("one", handedOff); err == nil {
+		t.Error("expected key written during handoff to be reported")
+	}
+	if item, ok := local.Get("one"); !ok || *item.Data != 3 {
+		t.Errorf("expected key written during handoff to be kept; got %v", item.Data)
+	}
+	current, _ := local.Get("one")
+	if err := p.removeHandedOff("one", current); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := local.Get("one"); ok {
+		t.Error("expected unchanged key to be removed after handoff")
+	}
+}
+
+func TestPartitioningOptIn(t *testing.T) {
+	m := New().WithServer("partition_disabled", WithPort(8223), WithSilence())
+	local := newCache[int]()
+	if _, err := NewPartitionedCache(m, "disabled_counts", local, Node{ID: "a", URL: m.Server().HTTPURL()}); err == nil {
+		t.Error("expected partitioned cache to require a server created WithPartitioning")
+	}
+	rec := httptest.NewRecorder()
+	m.Server().http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/partition_disabled/partition", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected partition route not to be served without WithPartitioning; got %d", rec.Code)
+	}
+}
+
+// waitForNoError retries fn until it succeeds, allowing servers time to start listening.
+func waitForNoError(t *testing.T, fn func() error) {
+	t.Helper()
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = fn(); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal(err)
+}
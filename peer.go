@@ -0,0 +1,117 @@
+package mnemo
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type (
+	// peer is an outgoing websocket connection to another Mnemo instance's server.
+	//
+	// Messages are written as json. The connection is re-established after
+	// any error until the peer is closed.
+	peer struct {
+		mu        sync.Mutex
+		url       string
+		header    http.Header
+		msgs      chan any
+		connected bool
+		cancel    context.CancelFunc
+		done      chan struct{}
+	}
+)
+
+// newPeer starts connecting to url in a go routine, sending header with every
+// connection request.
+func newPeer(url string, header http.Header, buffer int, reconnect time.Duration) *peer {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &peer{
+		url:    url,
+		header: header,
+		msgs:   make(chan any, buffer),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go p.run(ctx, reconnect)
+	return p
+}
+
+// send enqueues a message without blocking and reports whether it was queued.
+func (p *peer) send(msg any) bool {
+	select {
+	case p.msgs <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// isConnected reports whether the peer currently has an open connection.
+func (p *peer) isConnected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.connected
+}
+
+// close disconnects from the peer and stops reconnecting.
+func (p *peer) close() {
+	p.cancel()
+	<-p.done
+}
+
+func (p *peer) run(ctx context.Context, reconnect time.Duration) {
+	defer close(p.done)
+	for {
+		if err := p.connect(ctx); err != nil && ctx.Err() == nil {
+			NewError[peer](err.Error()).WithLogLevel(Debug).Log()
+		}
+		p.mu.Lock()
+		p.connected = false
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnect):
+		}
+	}
+}
+
+func (p *peer) connect(ctx context.Context) error {
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, p.url, p.header)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	p.mu.Lock()
+	p.connected = true
+	p.mu.Unlock()
+
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-closed:
+			return err
+		case msg := <-p.msgs:
+			if err := ws.WriteJSON(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package mnemo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type (
+	// Step is a step of a pipeline. Each step receives an input and returns an
+	// output, which is the input of the step after it.
+	Step interface {
+		run(ctx context.Context, p *pipelineRun, in any) (any, error)
+	}
+	// StepResult is the outcome of a command or transform run by a pipeline.
+	StepResult struct {
+		Step   string    `json:"step"`
+		Result any       `json:"result,omitempty"`
+		Error  string    `json:"error,omitempty"`
+		Start  time.Time `json:"start"`
+		End    time.Time `json:"end"`
+	}
+	// PipelineError is returned by a pipeline when one of its steps fails.
+	PipelineError struct {
+		// Step is the name of the first step that failed.
+		Step string
+		Err  error
+		// Steps are the outcomes of every step run before the pipeline stopped.
+		Steps []StepResult
+	}
+	// pipelineRun records the steps run by a single execution of a pipeline.
+	pipelineRun struct {
+		mu     sync.Mutex
+		cmds   *Commands
+		steps  []StepResult
+		failed int
+		err    error
+	}
+	// commandStep executes a command with its input or the arguments made from it.
+	commandStep struct {
+		key  CommandKey
+		args func(in any) (any, error)
+	}
+	// transformStep transforms its input with a function.
+	transformStep struct {
+		name string
+		fn   func(ctx context.Context, in any) (any, error)
+	}
+	// sequence runs steps one after the other, passing each output to the next step.
+	sequence []Step
+	// parallel runs steps at once with the same input and outputs their outputs in order.
+	parallel []Step
+	// conditional runs one of two steps depending on its input.
+	conditional struct {
+		cond      func(in any) bool
+		then      Step
+		otherwise Step
+	}
+	// invalidStep fails with the error of a step that was built incorrectly.
+	invalidStep struct {
+		err error
+	}
+)
+
+// Run returns a step that executes a command with its input as arguments.
+func Run(key CommandKey) Step {
+	return commandStep{key: key}
+}
+
+// RunWith returns a step that executes a command with arguments made from its input by fn.
+func RunWith(key CommandKey, fn func(in any) (any, error)) Step {
+	return commandStep{key: key, args: fn}
+}
+
+// Transform returns a step that outputs its input transformed by fn.
+func Transform(name string, fn func(ctx context.Context, in any) (any, error)) Step {
+	return transformStep{name: name, fn: fn}
+}
+
+// Sequence returns a step that runs steps in order, passing the output of each
+// step to the next, and outputs the output of the last step.
+func Sequence(steps ...Step) Step {
+	if err := checkSteps("sequence", steps); err != nil {
+		return invalidStep{err}
+	}
+	return sequence(steps)
+}
+
+// Parallel returns a step that runs steps at once with its input and outputs a
+// []any of their outputs in order. If a step fails the others are canceled.
+// A panic in a step is returned as the step's error.
+func Parallel(steps ...Step) Step {
+	if err := checkSteps("parallel", steps); err != nil {
+		return invalidStep{err}
+	}
+	return parallel(steps)
+}
+
+// When returns a step that runs then if cond is true for its input, and
+// otherwise if it is not. If otherwise is nil, the input is passed on.
+//
+// The step fails if cond or then is nil.
+func When(cond func(in any) bool, then Step, otherwise Step) Step {
+	if cond == nil || then == nil {
+		return invalidStep{NewError[Commands]("when requires a condition and a step to run")}
+	}
+	return conditional{cond: cond, then: then, otherwise: otherwise}
+}
+
+// checkSteps returns an error if any of a step's steps is nil.
+func checkSteps(name string, steps []Step) error {
+	for i, s := range steps {
+		if s == nil {
+			return NewError[Commands](fmt.Sprintf("%s step %d is nil", name, i))
+		}
+	}
+	return nil
+}
+
+// stepName returns the name a step is recorded under.
+func stepName(s Step) string {
+	switch s := s.(type) {
+	case commandStep:
+		return string(s.key)
+	case transformStep:
+		return s.name
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// Pipeline returns a command handler that runs steps in order, as Sequence does,
+// with the command's arguments as the input of the first step. The handler is
+// added to a collection with Register.
+//
+// Commands run by the pipeline are executed by the collection, so they are
+// wrapped in its middleware. If a step fails, the pipeline returns a
+// *PipelineError reporting it and the steps run before it.
+func (c *Commands) Pipeline(steps ...Step) CommandHandler {
+	seq := Sequence(steps...)
+	return func(ctx context.Context, args any) (any, error) {
+		p := &pipelineRun{cmds: c, failed: -1}
+		result, err := seq.run(ctx, p, args)
+		if err != nil {
+			return nil, p.error(err)
+		}
+		return result, nil
+	}
+}
+
+// Error implements the error interface.
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("pipeline failed at step '%s': %v", e.Step, e.Err)
+}
+
+// Unwrap returns the error of the failed step.
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// record records the outcome of a step, and it as the failure of the pipeline
+// if it is the first step to fail.
+func (p *pipelineRun) record(step string, start time.Time, result any, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := StepResult{Step: step, Result: result, Start: start, End: time.Now()}
+	if err != nil {
+		r.Result = nil
+		r.Error = err.Error()
+		if p.failed < 0 {
+			p.failed = len(p.steps)
+			p.err = err
+		}
+	}
+	p.steps = append(p.steps, r)
+}
+
+// error returns the error of a failed pipeline.
+func (p *pipelineRun) error(err error) *PipelineError {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := &PipelineError{Err: err, Steps: append([]StepResult{}, p.steps...)}
+	if p.failed >= 0 {
+		e.Step = p.steps[p.failed].Step
+		e.Err = p.err
+	}
+	return e
+}
+
+func (s commandStep) run(ctx context.Context, p *pipelineRun, in any) (any, error) {
+	start := time.Now()
+	args := in
+	if s.args != nil {
+		var err error
+		if args, err = s.args(in); err != nil {
+			p.record(string(s.key), start, nil, err)
+			return nil, err
+		}
+	}
+	result, err := p.cmds.Execute(ctx, s.key, args)
+	p.record(string(s.key), start, result, err)
+	return result, err
+}
+
+func (s transformStep) run(ctx context.Context, p *pipelineRun, in any) (any, error) {
+	start := time.Now()
+	out, err := s.fn(ctx, in)
+	p.record(s.name, start, out, err)
+	return out, err
+}
+
+func (s sequence) run(ctx context.Context, p *pipelineRun, in any) (any, error) {
+	for _, step := range s {
+		out, err := step.run(ctx, p, in)
+		if err != nil {
+			return nil, err
+		}
+		in = out
+	}
+	return in, nil
+}
+
+func (s parallel) run(ctx context.Context, p *pipelineRun, in any) (any, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	outs := make([]any, len(s))
+	errs := make([]error, len(s))
+	var wg sync.WaitGroup
+	for i, step := range s {
+		wg.Add(1)
+		go func(i int, step Step) {
+			start := time.Now()
+			defer wg.Done()
+			defer func() {
+				// steps run in their own goroutine, so a panic could not reach
+				// the command's middleware
+				if v := recover(); v != nil {
+					stack := debug.Stack()
+					if cp, ok := v.(*commandPanic); ok {
+						v, stack = cp.value, cp.stack
+					}
+					name := stepName(step)
+					err := NewError[Commands](fmt.Sprintf("step '%s' panicked: %v", name, v)).
+						WithStatus(http.StatusInternalServerError)
+					NewError[Commands](fmt.Sprintf("%v\n%s", err.Err, stack)).Log()
+					p.record(name, start, nil, err)
+					errs[i] = err
+					cancel()
+				}
+			}()
+			outs[i], errs[i] = step.run(ctx, p, in)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i, step)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return outs, nil
+}
+
+func (s invalidStep) run(ctx context.Context, p *pipelineRun, in any) (any, error) {
+	p.record("invalid", time.Now(), nil, s.err)
+	return nil, s.err
+}
+
+func (s conditional) run(ctx context.Context, p *pipelineRun, in any) (any, error) {
+	if s.cond(in) {
+		return s.then.run(ctx, p, in)
+	}
+	if s.otherwise == nil {
+		return in, nil
+	}
+	return s.otherwise.run(ctx, p, in)
+}
@@ -0,0 +1,131 @@
+package mnemo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPipelineCommands() *Commands {
+	c := NewCommands()
+	c.Register("double", Handler(func(ctx context.Context, n int) (int, error) {
+		return n * 2, nil
+	}))
+	c.Register("inc", Handler(func(ctx context.Context, n int) (int, error) {
+		return n + 1, nil
+	}))
+	c.Register("fail", func(ctx context.Context, args any) (any, error) {
+		return nil, errors.New("failed")
+	})
+	c.Register("wait", func(ctx context.Context, args any) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	return &c
+}
+
+func TestPipeline(t *testing.T) {
+	c := newPipelineCommands()
+	sum := Transform("sum", func(ctx context.Context, in any) (any, error) {
+		total := 0
+		for _, v := range in.([]any) {
+			total += v.(int)
+		}
+		return total, nil
+	})
+	c.Register("calc", c.Pipeline(
+		Run("double"),
+		Parallel(Run("inc"), Run("double")),
+		sum,
+		When(func(in any) bool { return in.(int) > 20 }, Run("inc"), nil),
+	))
+
+	// 3 -> 6 -> [7, 12] -> 19
+	if result, err := c.Execute(context.Background(), "calc", 3); err != nil || result != 19 {
+		t.Errorf("expected 19; got %v, %v", result, err)
+	}
+	// 5 -> 10 -> [11, 20] -> 31 -> 32
+	if result, err := c.Execute(context.Background(), "calc", 5); err != nil || result != 32 {
+		t.Errorf("expected 32; got %v, %v", result, err)
+	}
+
+	c.Register("args", c.Pipeline(RunWith("double", func(in any) (any, error) {
+		return in.(map[string]int)["n"], nil
+	})))
+	if result, _ := c.Execute(context.Background(), "args", map[string]int{"n": 4}); result != 8 {
+		t.Errorf("expected args made from input; got %v", result)
+	}
+
+	// pipelines are commands, so they can be composed and submitted as jobs
+	c.Register("nested", c.Pipeline(Run("calc"), Run("inc")))
+	id, _ := c.Submit("nested", 3)
+	if job, _ := c.Wait(context.Background(), id); job.Result != 20 {
+		t.Errorf("expected nested pipeline result; got %+v", job)
+	}
+}
+
+func TestPipelineFailure(t *testing.T) {
+	c := newPipelineCommands()
+	c.Register("broken", c.Pipeline(
+		Run("double"),
+		Parallel(Run("wait"), Run("fail")),
+		Run("inc"),
+	))
+	start := time.Now()
+	_, err := c.Execute(context.Background(), "broken", 1)
+	var perr *PipelineError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected pipeline error; got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expected parallel steps to be canceled when one fails")
+	}
+	if perr.Step != "fail" || perr.Err.Error() != "failed" {
+		t.Errorf("expected 'fail' step to be reported; got %q: %v", perr.Step, perr.Err)
+	}
+	var steps []string
+	for _, s := range perr.Steps {
+		steps = append(steps, s.Step)
+	}
+	if !reflect.DeepEqual(steps, []string{"double", "fail", "wait"}) {
+		t.Errorf("expected steps run before failure; got %v", steps)
+	}
+	if perr.Steps[0].Result != 2 || perr.Steps[2].Error == "" {
+		t.Errorf("unexpected step results %+v", perr.Steps)
+	}
+}
+
+func TestPipelinePanic(t *testing.T) {
+	c := newPipelineCommands()
+	boom := Transform("boom", func(ctx context.Context, in any) (any, error) {
+		panic("boom")
+	})
+	c.Register("panics", c.Pipeline(Parallel(Run("wait"), boom)))
+	_, err := c.Execute(context.Background(), "panics", 1)
+	var perr *PipelineError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected pipeline error; got %v", err)
+	}
+	if perr.Step != "boom" || !strings.Contains(perr.Err.Error(), "step 'boom' panicked: boom") {
+		t.Errorf("expected panic to be the step's error; got %q: %v", perr.Step, perr.Err)
+	}
+}
+
+func TestPipelineInvalidSteps(t *testing.T) {
+	c := newPipelineCommands()
+	always := func(in any) bool { return true }
+	for name, step := range map[CommandKey]Step{
+		"no_then":     When(always, nil, nil),
+		"no_cond":     When(nil, Run("inc"), nil),
+		"nil_step":    Parallel(Run("inc"), nil),
+		"nil_in_pipe": Sequence(nil),
+	} {
+		c.Register(name, c.Pipeline(step))
+		if _, err := c.Execute(context.Background(), name, 1); err == nil {
+			t.Errorf("expected %s to fail", name)
+		}
+	}
+}
@@ -18,11 +18,15 @@ func NewPool() *Pool {
 	}
 }
 
-// Conns returns a map of the pool's Conns
+// Conns returns a copy of the map of the pool's Conns
 func (p *Pool) Conns() map[interface{}]*Conn {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return p.conns
+	conns := make(map[interface{}]*Conn, len(p.conns))
+	for k, c := range p.conns {
+		conns[k] = c
+	}
+	return conns
 }
 
 // AddConn adds a Conn to the pool
@@ -38,17 +42,18 @@ func (p *Pool) AddConn(c *Conn) error {
 	return nil
 }
 
+// Close closes every Conn in the pool.
 func (p *Pool) Close() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	for _, c := range p.conns {
+	// Conns remove themselves from the pool as they close, so the pool must
+	// not be locked while they do
+	for _, c := range p.Conns() {
 		c.Close()
 	}
 }
 
-// RemoveConn removes a Conn from the pool
+// removeConnection removes a Conn from the pool
 func (p *Pool) removeConnection(c *Conn) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	delete(p.conns, c)
+	delete(p.conns, c.Key)
 }
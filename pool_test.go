@@ -0,0 +1,70 @@
+package mnemo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestConns opens n websocket connections to a test server and returns the
+// server side Conns.
+func newTestConns(t *testing.T, n int) []*Conn {
+	conns := make(chan *Conn, n)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := NewConn(w, r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- c
+	}))
+	t.Cleanup(srv.Close)
+	var out []*Conn
+	for i := 0; i < n; i++ {
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		out = append(out, <-conns)
+	}
+	return out
+}
+
+func TestPoolRemoveConnection(t *testing.T) {
+	p := NewPool()
+	conns := newTestConns(t, 2)
+	for _, c := range conns {
+		if err := p.AddConn(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conns[0].Close()
+	if _, ok := p.Conns()[conns[0].Key]; ok || len(p.Conns()) != 1 {
+		t.Errorf("expected closed connection to be removed; got %v", p.Conns())
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	p := NewPool()
+	for _, c := range newTestConns(t, 3) {
+		p.AddConn(c)
+	}
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected pool to close without deadlocking")
+	}
+	if len(p.Conns()) != 0 {
+		t.Errorf("expected closed pool to be empty; got %v", p.Conns())
+	}
+}
@@ -0,0 +1,561 @@
+package mnemo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type (
+	// Query selects, orders and pages the items of a cache.
+	//
+	// Fields are dotted paths into an item's json representation, e.g.
+	// 'created_at', 'version' or 'data.user.name', or 'key' for the item's key.
+	Query[T any] struct {
+		cache *Cache[T]
+		spec  QuerySpec
+		preds []func(T) bool
+	}
+	// QuerySpec is the json form of a Query.
+	QuerySpec struct {
+		// Index narrows the query to the items indexed by a value before any filters are applied.
+		Index   *QueryIndex      `json:"index,omitempty"`
+		Where   []QueryCondition `json:"where,omitempty"`
+		OrderBy []QueryOrder     `json:"order_by,omitempty"`
+		Limit   int              `json:"limit,omitempty"`
+		Offset  int              `json:"offset,omitempty"`
+		// Select projects rows to the given fields.
+		Select []string `json:"select,omitempty"`
+	}
+	// QueryIndex selects the items indexed by Value in the index Name.
+	QueryIndex struct {
+		Name  string `json:"name"`
+		Value any    `json:"value"`
+	}
+	// QueryCondition filters items by a field.
+	//
+	// Op is one of 'eq', 'ne', 'lt', 'lte', 'gt', 'gte', 'in', 'contains' or 'prefix'.
+	QueryCondition struct {
+		Field string `json:"field"`
+		Op    string `json:"op"`
+		Value any    `json:"value"`
+	}
+	// QueryOrder orders items by a field.
+	QueryOrder struct {
+		Field string `json:"field"`
+		Desc  bool   `json:"desc,omitempty"`
+	}
+	// QueryResult is an item matched by a query.
+	QueryResult[T any] struct {
+		Key  CacheKey `json:"key"`
+		Item Item[T]  `json:"item"`
+	}
+	// QueryRequest runs a query against a cache of a remote Mnemo instance.
+	QueryRequest struct {
+		// Type is 'query' when the request is sent over a websocket connection.
+		Type  string    `json:"type,omitempty"`
+		ID    string    `json:"id,omitempty"`
+		Store StoreKey  `json:"store"`
+		Cache any       `json:"cache"`
+		Query QuerySpec `json:"query"`
+	}
+	// QueryResponse holds the rows matched by a QueryRequest.
+	QueryResponse struct {
+		Type string           `json:"type,omitempty"`
+		ID   string           `json:"id,omitempty"`
+		Rows []map[string]any `json:"rows"`
+		// Total is the number of matching items before limit and offset are applied.
+		Total int    `json:"total"`
+		Error string `json:"error,omitempty"`
+	}
+	// queryable is implemented by every Cache so caches of any type can be
+	// queried from json.
+	queryable interface {
+		query(spec QuerySpec) (rows []map[string]any, total int, err error)
+	}
+	// queryRow is a candidate item with its json representation decoded on demand.
+	queryRow[T any] struct {
+		key  CacheKey
+		item Item[T]
+		doc  map[string]any
+	}
+)
+
+// Query returns a query over every item in the cache.
+func (c *Cache[T]) Query() *Query[T] {
+	return &Query[T]{cache: c}
+}
+
+// QueryFrom returns a query built from its json form.
+func (c *Cache[T]) QueryFrom(spec QuerySpec) *Query[T] {
+	return &Query[T]{cache: c, spec: spec}
+}
+
+// Index narrows the query to the items indexed by value in the named index.
+func (q *Query[T]) Index(name string, value any) *Query[T] {
+	q.spec.Index = &QueryIndex{Name: name, Value: value}
+	return q
+}
+
+// Where filters items by a predicate. Predicates cannot be expressed as json.
+func (q *Query[T]) Where(fn func(data T) bool) *Query[T] {
+	q.preds = append(q.preds, fn)
+	return q
+}
+
+// WhereField filters items by comparing a field to value.
+func (q *Query[T]) WhereField(field string, op string, value any) *Query[T] {
+	q.spec.Where = append(q.spec.Where, QueryCondition{Field: field, Op: op, Value: value})
+	return q
+}
+
+// OrderBy orders items by a field in ascending order.
+// Later orderings break ties in earlier ones.
+func (q *Query[T]) OrderBy(field string) *Query[T] {
+	q.spec.OrderBy = append(q.spec.OrderBy, QueryOrder{Field: field})
+	return q
+}
+
+// OrderByDesc orders items by a field in descending order.
+func (q *Query[T]) OrderByDesc(field string) *Query[T] {
+	q.spec.OrderBy = append(q.spec.OrderBy, QueryOrder{Field: field, Desc: true})
+	return q
+}
+
+// Limit returns at most n items. There is no limit if n is 0.
+func (q *Query[T]) Limit(n int) *Query[T] {
+	q.spec.Limit = n
+	return q
+}
+
+// Offset skips the first n items.
+func (q *Query[T]) Offset(n int) *Query[T] {
+	q.spec.Offset = n
+	return q
+}
+
+// Select projects the rows returned by Rows to the given fields.
+func (q *Query[T]) Select(fields ...string) *Query[T] {
+	q.spec.Select = append(q.spec.Select, fields...)
+	return q
+}
+
+// Spec returns the json form of the query, without any predicates added with Where.
+func (q *Query[T]) Spec() QuerySpec {
+	return q.spec
+}
+
+// Run returns the matching items.
+//
+// Items are ordered by creation time and key unless the query orders them
+// otherwise. Select has no effect on Run.
+func (q *Query[T]) Run() ([]QueryResult[T], error) {
+	rows, _, err := q.run()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]QueryResult[T], len(rows))
+	for i, r := range rows {
+		results[i] = QueryResult[T]{Key: r.key, Item: r.item}
+	}
+	return results, nil
+}
+
+// Count returns the number of matching items, ignoring limit and offset.
+func (q *Query[T]) Count() (int, error) {
+	_, total, err := q.run()
+	return total, err
+}
+
+// Rows returns the matching items in json form, projected to the selected
+// fields, along with the number of matching items before paging.
+func (q *Query[T]) Rows() ([]map[string]any, int, error) {
+	rows, total, err := q.run()
+	if err != nil {
+		return nil, 0, err
+	}
+	out := make([]map[string]any, len(rows))
+	for i, r := range rows {
+		doc := r.document()
+		if len(q.spec.Select) == 0 {
+			out[i] = doc
+			continue
+		}
+		projected := make(map[string]any)
+		for _, field := range q.spec.Select {
+			if v, ok := lookupField(doc, field); ok {
+				setField(projected, field, v)
+			}
+		}
+		out[i] = projected
+	}
+	return out, total, nil
+}
+
+// run returns the page of matching rows and the total number of matches.
+func (q *Query[T]) run() ([]*queryRow[T], int, error) {
+	for _, cond := range q.spec.Where {
+		if !validOp(cond.Op) {
+			return nil, 0, NewError[Query[T]](fmt.Sprintf("unknown operator '%s'", cond.Op))
+		}
+	}
+	if q.spec.Limit < 0 || q.spec.Offset < 0 {
+		return nil, 0, NewError[Query[T]]("limit and offset must not be negative")
+	}
+	rows, err := q.candidates()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matches := rows[:0]
+	for _, r := range rows {
+		if q.match(r) {
+			matches = append(matches, r)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return q.less(matches[i], matches[j])
+	})
+
+	total := len(matches)
+	start := min(q.spec.Offset, total)
+	end := total
+	if q.spec.Limit > 0 {
+		end = min(start+q.spec.Limit, total)
+	}
+	return matches[start:end], total, nil
+}
+
+// candidates copies the items the query runs over, using its index if it has one.
+func (q *Query[T]) candidates() ([]*queryRow[T], error) {
+	c := q.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if q.spec.Index == nil {
+		rows := make([]*queryRow[T], 0, len(c.raw.caches))
+		for key, item := range c.raw.caches {
+			rows = append(rows, &queryRow[T]{key: key, item: *item})
+		}
+		return rows, nil
+	}
+
+	value := q.spec.Index.Value
+	if idx, ok := c.indexes[q.spec.Index.Name]; ok {
+		value = idx.coerce(value)
+	}
+	keys, err := c.lookupKeys(q.spec.Index.Name, value)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]*queryRow[T], 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, &queryRow[T]{key: key, item: *c.raw.caches[key]})
+	}
+	return rows, nil
+}
+
+func (q *Query[T]) match(r *queryRow[T]) bool {
+	for _, pred := range q.preds {
+		if r.item.Data == nil || !pred(*r.item.Data) {
+			return false
+		}
+	}
+	for _, cond := range q.spec.Where {
+		v, _ := lookupField(r.document(), cond.Field)
+		if !compareOp(v, cond.Op, normalize(cond.Value)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *Query[T]) less(a, b *queryRow[T]) bool {
+	for _, o := range q.spec.OrderBy {
+		av, _ := lookupField(a.document(), o.Field)
+		bv, _ := lookupField(b.document(), o.Field)
+		n := compareValues(av, bv)
+		if n == 0 {
+			continue
+		}
+		if o.Desc {
+			return n > 0
+		}
+		return n < 0
+	}
+	if !a.item.CreatedAt.Equal(b.item.CreatedAt) {
+		return a.item.CreatedAt.Before(b.item.CreatedAt)
+	}
+	return fmt.Sprint(a.key) < fmt.Sprint(b.key)
+}
+
+// document returns the row's json representation with its key.
+func (r *queryRow[T]) document() map[string]any {
+	if r.doc != nil {
+		return r.doc
+	}
+	r.doc = make(map[string]any)
+	if b, err := json.Marshal(r.item); err == nil {
+		json.Unmarshal(b, &r.doc)
+	}
+	r.doc["key"] = normalize(r.key)
+	return r.doc
+}
+
+// query implements the queryable interface.
+func (c *Cache[T]) query(spec QuerySpec) ([]map[string]any, int, error) {
+	return c.QueryFrom(spec).Rows()
+}
+
+// coerce converts a value decoded from json to the type of the index's values
+// so that e.g. a float64 can look up an int.
+func (idx *index[T]) coerce(value any) any {
+	if value == nil {
+		return nil
+	}
+	for v := range idx.entries {
+		t := reflect.TypeOf(v)
+		if reflect.TypeOf(value) == t {
+			return value
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return value
+		}
+		ptr := reflect.New(t)
+		if err := json.Unmarshal(b, ptr.Interface()); err != nil {
+			return value
+		}
+		return ptr.Elem().Interface()
+	}
+	return value
+}
+
+// normalize converts a value to the form encoding/json decodes it to.
+func normalize(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// lookupField returns the value at a dotted path in a json document.
+func lookupField(doc map[string]any, path string) (any, bool) {
+	var cur any = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// setField sets the value at a dotted path in a json document.
+func setField(doc map[string]any, path string, v any) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			doc[part] = next
+		}
+		doc = next
+	}
+	doc[parts[len(parts)-1]] = v
+}
+
+func validOp(op string) bool {
+	switch op {
+	case "eq", "ne", "lt", "lte", "gt", "gte", "in", "contains", "prefix":
+		return true
+	}
+	return false
+}
+
+// compareOp applies a condition's operator to a field's value and the condition's value.
+func compareOp(field any, op string, value any) bool {
+	switch op {
+	case "eq":
+		return reflect.DeepEqual(field, value)
+	case "ne":
+		return !reflect.DeepEqual(field, value)
+	case "lt", "lte", "gt", "gte":
+		if !orderable(field, value) {
+			return false
+		}
+		n := compareValues(field, value)
+		switch op {
+		case "lt":
+			return n < 0
+		case "lte":
+			return n <= 0
+		case "gt":
+			return n > 0
+		}
+		return n >= 0
+	case "in":
+		values, ok := value.([]any)
+		if !ok {
+			return false
+		}
+		for _, v := range values {
+			if reflect.DeepEqual(field, v) {
+				return true
+			}
+		}
+	case "contains":
+		switch f := field.(type) {
+		case string:
+			s, ok := value.(string)
+			return ok && strings.Contains(f, s)
+		case []any:
+			for _, v := range f {
+				if reflect.DeepEqual(v, value) {
+					return true
+				}
+			}
+		}
+	case "prefix":
+		f, ok := field.(string)
+		s, ok2 := value.(string)
+		return ok && ok2 && strings.HasPrefix(f, s)
+	}
+	return false
+}
+
+// orderable reports whether two json values can be ordered against each other.
+func orderable(a, b any) bool {
+	switch a.(type) {
+	case float64:
+		_, ok := b.(float64)
+		return ok
+	case string:
+		_, ok := b.(string)
+		return ok
+	case bool:
+		_, ok := b.(bool)
+		return ok
+	}
+	return false
+}
+
+// compareValues orders json values. Missing values sort first, and values of
+// different kinds are ordered by kind.
+func compareValues(a, b any) int {
+	ka, kb := kindOrder(a), kindOrder(b)
+	if ka != kb {
+		return ka - kb
+	}
+	switch a := a.(type) {
+	case float64:
+		b := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		b := b.(bool)
+		switch {
+		case !a && b:
+			return -1
+		case a && !b:
+			return 1
+		}
+	}
+	return 0
+}
+
+func kindOrder(v any) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	}
+	return 4
+}
+
+// handleQuery runs a query sent by a websocket connection and sends it the response.
+func (s *Server) handleQuery(c *Conn, msg []byte) {
+	var req QueryRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		c.send(QueryResponse{Type: "query", Error: err.Error()})
+		return
+	}
+	c.send(s.runQuery(req))
+}
+
+// runQuery runs a query request against a store added to the server's Mnemo instance.
+func (s *Server) runQuery(req QueryRequest) QueryResponse {
+	resp := QueryResponse{Type: req.Type, ID: req.ID, Rows: []map[string]any{}}
+	if s.mnemo == nil {
+		resp.Error = "server has no mnemo instance"
+		return resp
+	}
+	store, err := UseStore(req.Store)
+	if err != nil || !s.mnemo.hasStore(req.Store) {
+		resp.Error = fmt.Sprintf("no store with key '%v'", req.Store)
+		return resp
+	}
+	var target any
+	for key, c := range store.caches() {
+		if key == req.Cache {
+			target = c
+			break
+		}
+		// keys decoded from json may differ in type, e.g. float64 for int
+		if fmt.Sprint(key) == fmt.Sprint(req.Cache) {
+			target = c
+		}
+	}
+	qc, ok := target.(queryable)
+	if !ok {
+		resp.Error = fmt.Sprintf("no cache with key '%v'", req.Cache)
+		return resp
+	}
+	rows, total, err := qc.query(req.Query)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Rows, resp.Total = rows, total
+	return resp
+}
+
+// HandleQuery runs a QueryRequest posted as json and responds with a QueryResponse.
+func (s *Server) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := s.runQuery(req)
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,176 @@
+package mnemo
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type queryUser struct {
+	Name string   `json:"name"`
+	Age  int      `json:"age"`
+	Team string   `json:"team"`
+	Tags []string `json:"tags"`
+}
+
+func newQueryCache() *Cache[queryUser] {
+	cache := newCache[queryUser]()
+	cache.Set(1, queryUser{Name: "ann", Age: 31, Team: "red", Tags: []string{"admin"}})
+	cache.Set(2, queryUser{Name: "bob", Age: 25, Team: "blue"})
+	cache.Set(3, queryUser{Name: "cat", Age: 42, Team: "red", Tags: []string{"dev"}})
+	cache.Set(4, queryUser{Name: "dan", Age: 19, Team: "red", Tags: []string{"dev", "admin"}})
+	return cache
+}
+
+func TestQuery(t *testing.T) {
+	cache := newQueryCache()
+	results, err := cache.Query().
+		WhereField("data.team", "eq", "red").
+		WhereField("data.age", "gte", 20).
+		OrderByDesc("data.age").
+		Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Key != 3 || results[1].Key != 1 {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	results, _ = cache.Query().
+		Where(func(u queryUser) bool { return len(u.Tags) > 0 }).
+		WhereField("data.tags", "contains", "admin").
+		Run()
+	if len(results) != 2 {
+		t.Errorf("expected two admins; got %d", len(results))
+	}
+
+	if _, err := cache.Query().WhereField("data.age", "like", 1).Run(); err == nil {
+		t.Error("expected error for unknown operator")
+	}
+}
+
+func TestQueryPagination(t *testing.T) {
+	cache := newQueryCache()
+	q := cache.Query().OrderBy("data.name").Offset(1).Limit(2).Select("key", "data.name")
+	rows, total, err := q.Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 || len(rows) != 2 {
+		t.Fatalf("expected page of 2 out of 4; got %d of %d", len(rows), total)
+	}
+	data := rows[0]["data"].(map[string]any)
+	if data["name"] != "bob" || rows[1]["data"].(map[string]any)["name"] != "cat" {
+		t.Errorf("unexpected page %v", rows)
+	}
+	if _, ok := data["age"]; ok {
+		t.Error("expected unselected fields to be projected out")
+	}
+	if rows[0]["key"] != float64(2) {
+		t.Errorf("expected selected key; got %v", rows[0]["key"])
+	}
+}
+
+func TestQueryIndex(t *testing.T) {
+	cache := newQueryCache()
+	cache.AddIndex("byTeam", func(u queryUser) any { return u.Team })
+	results, err := cache.Query().Index("byTeam", "red").WhereField("data.tags", "contains", "dev").Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Errorf("expected two red devs; got %d", len(results))
+	}
+	if _, err := cache.Query().Index("missing", "red").Run(); err == nil {
+		t.Error("expected error for missing index")
+	}
+}
+
+func TestQuerySpecJSON(t *testing.T) {
+	cache := newQueryCache()
+	cache.AddIndex("byAge", func(u queryUser) any { return u.Age })
+	raw := `{"index":{"name":"byAge","value":25},"select":["data.name"]}`
+	var spec QuerySpec
+	if err := json.Unmarshal([]byte(raw), &spec); err != nil {
+		t.Fatal(err)
+	}
+	rows, _, err := cache.QueryFrom(spec).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["data"].(map[string]any)["name"] != "bob" {
+		t.Errorf("expected json index value to match int index; got %v", rows)
+	}
+}
+
+func TestHandleQuery(t *testing.T) {
+	var key StoreKey = "query_store"
+	NewStore(key)
+	cache, _ := NewCache[queryUser](key, "users")
+	for k, item := range newQueryCache().GetAll() {
+		cache.Set(k, *item.Data)
+	}
+	m := New().WithServer("query", WithPort(8210), WithSilence())
+	m.WithStores(key)
+	m.Server().ListenAndServe()
+	t.Cleanup(func() { m.Server().Shutdown() })
+
+	req := QueryRequest{
+		Store: key,
+		Cache: "users",
+		Query: QuerySpec{
+			Where:   []QueryCondition{{Field: "data.team", Op: "in", Value: []string{"blue"}}},
+			OrderBy: []QueryOrder{{Field: "key"}},
+		},
+	}
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	m.Server().HandleQuery(rec, httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body)))
+	var resp QueryResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.Total != 1 || resp.Rows[0]["data"].(map[string]any)["name"] != "bob" {
+		t.Errorf("unexpected http response %d %+v", rec.Code, resp)
+	}
+
+	req.Cache = "missing"
+	body, _ = json.Marshal(req)
+	rec = httptest.NewRecorder()
+	m.Server().HandleQuery(rec, httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for missing cache; got %d", rec.Code)
+	}
+
+	var ws *websocket.Conn
+	waitForNoError(t, func() error {
+		var err error
+		ws, _, err = websocket.DefaultDialer.Dial(m.Server().URL()+"/subscribe", nil)
+		return err
+	})
+	defer ws.Close()
+	ws.WriteJSON(QueryRequest{
+		Type:  "query",
+		ID:    "q1",
+		Store: key,
+		Cache: "users",
+		Query: QuerySpec{Where: []QueryCondition{{Field: "data.age", Op: "lt", Value: 30}}},
+	})
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		var resp QueryResponse
+		if err := ws.ReadJSON(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.ID != "q1" {
+			continue
+		}
+		if resp.Total != 2 {
+			t.Errorf("expected two users under 30 over websocket; got %+v", resp)
+		}
+		break
+	}
+}
@@ -0,0 +1,538 @@
+package mnemo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	msgSnapshot  replicationMessageType = "snapshot"
+	msgMutation  replicationMessageType = "mutation"
+	msgReady     replicationMessageType = "ready"
+	msgHeartbeat replicationMessageType = "heartbeat"
+)
+
+type (
+	// replica is implemented by every Cache so caches of any type can be
+	// replicated between Mnemo instances.
+	replica interface {
+		replicate(fn func(replicaEvent)) (cancel func(), err error)
+		applySnapshot(items []wireItem) error
+		applyMutation(op mutationOp, key wireKey, item json.RawMessage) error
+	}
+	// replicaEvent is a snapshot or mutation of a single cache in wire form.
+	replicaEvent struct {
+		Type  replicationMessageType
+		Op    mutationOp
+		Key   wireKey
+		Item  json.RawMessage
+		Items []wireItem
+	}
+	replicationMessageType string
+	// replicationMessage is sent from a leader to its followers.
+	replicationMessage struct {
+		Type  replicationMessageType `json:"type"`
+		Seq   uint64                 `json:"seq"`
+		Time  time.Time              `json:"time"`
+		Store StoreKey               `json:"store,omitempty"`
+		Cache *wireKey               `json:"cache,omitempty"`
+		Op    mutationOp             `json:"op,omitempty"`
+		Key   *wireKey               `json:"key,omitempty"`
+		Item  json.RawMessage        `json:"item,omitempty"`
+		Items []wireItem             `json:"items,omitempty"`
+	}
+	// replicationStream is a leader's outgoing stream to one follower.
+	replicationStream struct {
+		mu   sync.Mutex
+		seq  uint64
+		msgs chan replicationMessage
+		stop chan struct{}
+		once sync.Once
+	}
+	// Follower replicates stores from a leader's server into local stores.
+	//
+	// A follower receives a full snapshot of every cache in the followed stores,
+	// then streams mutations to keep local caches in sync. Local caches must be
+	// created with the same cache keys and types as the leader's caches.
+	// After a disconnection the follower reconnects and resyncs from a new snapshot.
+	Follower struct {
+		mu     sync.Mutex
+		mnemo  *Mnemo
+		url    string
+		stores map[StoreKey]StoreKey
+		cfg    followerConfig
+		stats  ReplicationStats
+		conn   *websocket.Conn
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+	followerConfig struct {
+		Reconnect time.Duration
+		Header    http.Header
+	}
+	// ReplicationStats describes the state of a follower.
+	ReplicationStats struct {
+		// Connected is true while the follower is connected to the leader.
+		Connected bool `json:"connected"`
+		// Synced is true once the current connection's snapshot has been applied.
+		Synced bool `json:"synced"`
+		// Syncs is the number of snapshots applied, including resyncs.
+		Syncs int `json:"syncs"`
+		// LastSync is the time the last snapshot was applied.
+		LastSync time.Time `json:"last_sync"`
+		// Applied is the number of mutations applied since the follower started.
+		Applied uint64 `json:"applied"`
+		// LeaderSeq is the latest sequence number reported by the leader.
+		LeaderSeq uint64 `json:"leader_seq"`
+		// AppliedSeq is the sequence number of the last message applied.
+		AppliedSeq uint64 `json:"applied_seq"`
+		// Lag is the time between the leader sending and the follower
+		// applying the last message.
+		Lag time.Duration `json:"lag"`
+	}
+)
+
+// SeqLag returns the number of messages the follower is behind the leader.
+func (rs ReplicationStats) SeqLag() uint64 {
+	if rs.LeaderSeq < rs.AppliedSeq {
+		return 0
+	}
+	return rs.LeaderSeq - rs.AppliedSeq
+}
+
+// HandleReplicate upgrades the http connection to a websocket connection
+// and streams the requested stores to a follower.
+//
+// Stores are requested with one or more 'store' query parameters and must
+// belong to the server's Mnemo instance.
+// The route is only served by servers created WithReplication.
+func (s *Server) HandleReplicate(w http.ResponseWriter, r *http.Request) {
+	if s.mnemo == nil {
+		http.Error(w, "server has no mnemo instance", http.StatusServiceUnavailable)
+		return
+	}
+	keys := r.URL.Query()["store"]
+	stores := make([]*Store, 0, len(keys))
+	for _, k := range keys {
+		store, err := UseStore(StoreKey(k))
+		if err != nil || !s.mnemo.hasStore(StoreKey(k)) {
+			http.Error(w, fmt.Sprintf("no store with key '%v'", k), http.StatusNotFound)
+			return
+		}
+		stores = append(stores, store)
+	}
+
+	upgrader := websocket.Upgrader{}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		NewError[Server](err.Error()).Log()
+		return
+	}
+	defer ws.Close()
+
+	stream := &replicationStream{
+		msgs: make(chan replicationMessage, s.cfg.ReplicationBuffer),
+		stop: make(chan struct{}),
+	}
+	for _, store := range stores {
+		for ck, c := range store.caches() {
+			rc, ok := c.(replica)
+			if !ok {
+				continue
+			}
+			wk, err := encodeKey(ck)
+			if err != nil {
+				NewError[Server](err.Error()).Log()
+				continue
+			}
+			storeKey := store.Key()
+			cancel, err := rc.replicate(func(e replicaEvent) {
+				key := e.Key
+				stream.send(replicationMessage{
+					Type:  e.Type,
+					Store: storeKey,
+					Cache: &wk,
+					Op:    e.Op,
+					Key:   &key,
+					Item:  e.Item,
+					Items: e.Items,
+				})
+			})
+			if err != nil {
+				NewError[Server](err.Error()).Log()
+				continue
+			}
+			defer cancel()
+		}
+	}
+	stream.send(replicationMessage{Type: msgReady})
+
+	// detect the follower closing the connection
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				stream.close()
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(s.cfg.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-stream.msgs:
+			if err := ws.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			stream.mu.Lock()
+			seq := stream.seq
+			stream.mu.Unlock()
+			hb := replicationMessage{Type: msgHeartbeat, Seq: seq, Time: time.Now()}
+			if err := ws.WriteJSON(hb); err != nil {
+				return
+			}
+		case <-stream.stop:
+			return
+		}
+	}
+}
+
+// send sequences and enqueues a message without blocking.
+//
+// If the follower has fallen too far behind the stream is closed and the
+// follower must resync.
+func (rs *replicationStream) send(msg replicationMessage) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.seq++
+	msg.Seq = rs.seq
+	msg.Time = time.Now()
+	select {
+	case rs.msgs <- msg:
+	default:
+		NewError[replicationStream]("follower fell behind; closing stream").WithLogLevel(Warn).Log()
+		rs.close()
+	}
+}
+
+func (rs *replicationStream) close() {
+	rs.once.Do(func() { close(rs.stop) })
+}
+
+// WithReconnectInterval sets how long a follower waits before reconnecting to its leader.
+func WithReconnectInterval(d time.Duration) Opt[Follower] {
+	return func(f *Follower) {
+		f.cfg.Reconnect = d
+	}
+}
+
+// WithFollowerHeader sets the header sent when connecting to the leader, such as
+// the credentials required by its server's authenticator.
+func WithFollowerHeader(header http.Header) Opt[Follower] {
+	return func(f *Follower) {
+		f.cfg.Header = header
+	}
+}
+
+// NewFollower creates a follower of the leader server at url.
+//
+// The url is the leader server's base websocket url, e.g. 'ws://localhost:8080/leader'.
+// The leader's server must be created WithReplication.
+func NewFollower(m *Mnemo, url string, opts ...Opt[Follower]) *Follower {
+	f := &Follower{
+		mnemo:  m,
+		url:    url,
+		stores: make(map[StoreKey]StoreKey),
+		cfg: followerConfig{
+			Reconnect: time.Second,
+		},
+	}
+	for _, o := range opts {
+		o(f)
+	}
+	return f
+}
+
+// Follow replicates the leader's remote store into the follower's local store.
+//
+// Follow must be called before Start.
+func (f *Follower) Follow(remote StoreKey, local StoreKey) *Follower {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stores[remote] = local
+	return f
+}
+
+// Start connects to the leader in a go routine and keeps reconnecting until Stop is called.
+func (f *Follower) Start() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	f.done = make(chan struct{})
+	go f.run(ctx)
+}
+
+// Stop disconnects from the leader and stops reconnecting.
+func (f *Follower) Stop() {
+	f.mu.Lock()
+	cancel, done := f.cancel, f.done
+	f.cancel = nil
+	if cancel == nil {
+		f.mu.Unlock()
+		return
+	}
+	// cancel before taking the connection, as connect only keeps a connection
+	// it opened while holding the lock if ctx is not cancelled
+	cancel()
+	conn := f.conn
+	f.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	<-done
+}
+
+// Stats returns the follower's replication statistics.
+func (f *Follower) Stats() ReplicationStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stats
+}
+
+// run connects to the leader and applies messages until ctx is cancelled.
+func (f *Follower) run(ctx context.Context) {
+	defer close(f.done)
+	for {
+		if err := f.connect(ctx); err != nil && ctx.Err() == nil {
+			NewError[Follower](err.Error()).WithLogLevel(Debug).Log()
+		}
+		f.mu.Lock()
+		f.conn = nil
+		f.stats.Connected = false
+		f.stats.Synced = false
+		f.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(f.cfg.Reconnect):
+		}
+	}
+}
+
+// connect opens a single connection to the leader and applies messages until it closes.
+func (f *Follower) connect(ctx context.Context) error {
+	f.mu.Lock()
+	q := url.Values{}
+	for remote := range f.stores {
+		q.Add("store", string(remote))
+	}
+	f.mu.Unlock()
+
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, f.url+"/replicate?"+q.Encode(), f.cfg.Header)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	f.mu.Lock()
+	if ctx.Err() != nil {
+		f.mu.Unlock()
+		return nil
+	}
+	f.conn = ws
+	f.stats.Connected = true
+	f.mu.Unlock()
+
+	for {
+		var msg replicationMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			return err
+		}
+		if err := f.apply(msg); err != nil {
+			NewError[Follower](err.Error()).Log()
+		}
+	}
+}
+
+// apply applies a single message from the leader.
+func (f *Follower) apply(msg replicationMessage) error {
+	var err error
+	switch msg.Type {
+	case msgSnapshot, msgMutation:
+		var rc replica
+		rc, err = f.replica(msg)
+		if err == nil && msg.Type == msgSnapshot {
+			err = rc.applySnapshot(msg.Items)
+		}
+		if err == nil && msg.Type == msgMutation && msg.Key != nil {
+			err = rc.applyMutation(msg.Op, *msg.Key, msg.Item)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if msg.Seq > f.stats.LeaderSeq {
+		f.stats.LeaderSeq = msg.Seq
+	}
+	switch msg.Type {
+	case msgHeartbeat:
+		if f.stats.AppliedSeq >= msg.Seq {
+			f.stats.Lag = time.Since(msg.Time)
+		}
+		return err
+	case msgReady:
+		f.stats.Synced = true
+		f.stats.Syncs++
+		f.stats.LastSync = time.Now()
+	case msgMutation:
+		f.stats.Applied++
+	}
+	f.stats.AppliedSeq = msg.Seq
+	f.stats.Lag = time.Since(msg.Time)
+	return err
+}
+
+// replica finds the local cache a message applies to.
+func (f *Follower) replica(msg replicationMessage) (replica, error) {
+	f.mu.Lock()
+	local, ok := f.stores[msg.Store]
+	f.mu.Unlock()
+	if !ok || msg.Cache == nil {
+		return nil, NewError[Follower](fmt.Sprintf("not following store '%v'", msg.Store))
+	}
+	if f.mnemo != nil && !f.mnemo.hasStore(local) {
+		return nil, NewError[Follower](fmt.Sprintf("store '%v' does not belong to mnemo instance", local))
+	}
+	store, err := UseStore(local)
+	if err != nil {
+		return nil, err
+	}
+	ck, err := decodeKey(*msg.Cache)
+	if err != nil {
+		return nil, err
+	}
+	c, err := store.getCache(ck)
+	if err != nil {
+		return nil, err
+	}
+	rc, ok := c.(replica)
+	if !ok {
+		return nil, NewError[Follower](fmt.Sprintf("cache with key '%v' cannot be replicated", ck))
+	}
+	return rc, nil
+}
+
+// replicate sends a snapshot of the cache to fn and then every subsequent mutation.
+func (c *Cache[T]) replicate(fn func(replicaEvent)) (cancel func(), err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	items := make([]wireItem, 0, len(c.raw.caches))
+	for k, item := range c.raw.caches {
+		wk, err := encodeKey(k)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(item)
+		if err != nil {
+			return nil, NewError[Cache[T]](err.Error())
+		}
+		items = append(items, wireItem{Key: wk, Item: b})
+	}
+	fn(replicaEvent{Type: msgSnapshot, Items: items})
+
+	return c.listenLocked(func(m mutation[T]) {
+		wk, err := encodeKey(m.Key)
+		if err != nil {
+			NewError[Cache[T]](err.Error()).Log()
+			return
+		}
+		b, err := json.Marshal(m.Item)
+		if err != nil {
+			NewError[Cache[T]](err.Error()).Log()
+			return
+		}
+		fn(replicaEvent{Type: msgMutation, Op: m.Op, Key: wk, Item: b})
+	}), nil
+}
+
+// applySnapshot replaces the contents of the cache with a snapshot from a leader.
+func (c *Cache[T]) applySnapshot(items []wireItem) error {
+	next := make(map[CacheKey]*Item[T], len(items))
+	for _, wi := range items {
+		k, err := decodeKey(wi.Key)
+		if err != nil {
+			return err
+		}
+		var item Item[T]
+		if err := json.Unmarshal(wi.Item, &item); err != nil {
+			return NewError[Cache[T]](err.Error())
+		}
+		next[k] = &item
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// items that fail to apply are skipped so the rest of the snapshot is applied
+	var errs []error
+	// mergeable caches converge by merging and never drop keys on resync
+	if _, ok := any(*new(T)).(Mergeable[T]); ok {
+		for k, item := range next {
+			if _, _, err := c.merge(k, *item, sourceRemote); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	for k := range c.raw.caches {
+		if _, ok := next[k]; !ok {
+			if _, err := c.remove(k, sourceRemote); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	for k, item := range next {
+		if err := c.put(k, *item, sourceRemote); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyMutation applies a single mutation from a leader.
+func (c *Cache[T]) applyMutation(op mutationOp, key wireKey, raw json.RawMessage) error {
+	k, err := decodeKey(key)
+	if err != nil {
+		return err
+	}
+	var item Item[T]
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return NewError[Cache[T]](err.Error())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if op == opDelete {
+		_, err := c.remove(k, sourceRemote)
+		return err
+	}
+	if _, ok, err := c.merge(k, item, sourceRemote); ok {
+		return err
+	}
+	return c.put(k, item, sourceRemote)
+}
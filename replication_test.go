@@ -0,0 +1,131 @@
+package mnemo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it returns true or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met before timeout")
+}
+
+func TestReplication(t *testing.T) {
+	var (
+		leaderStore   StoreKey = "replication_leader"
+		followerStore StoreKey = "replication_follower"
+		cacheKey      CacheKey = "messages"
+	)
+	leader := New().WithServer("replication_leader", WithPort(8201), WithSilence(), WithReplication(), WithHeartbeat(50*time.Millisecond))
+	NewStore(leaderStore)
+	leader.WithStores(leaderStore)
+	lc, err := NewCache[string](leaderStore, cacheKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one, two := "one", "two"
+	lc.Cache(1, &one)
+	lc.Cache("two", &two)
+	leader.Server().ListenAndServe()
+	defer leader.Server().Shutdown()
+
+	follower := New()
+	NewStore(followerStore)
+	follower.WithStores(followerStore)
+	fc, err := NewCache[string](followerStore, cacheKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFollower(follower, leader.Server().URL(), WithReconnectInterval(20*time.Millisecond)).
+		Follow(leaderStore, followerStore)
+	f.Start()
+	defer f.Stop()
+
+	waitFor(t, 2*time.Second, func() bool { return f.Stats().Synced })
+	item, ok := fc.Get(1)
+	if !ok || *item.Data != "one" {
+		t.Fatalf("expected snapshot to contain int key 1; got %v", fc.GetAll())
+	}
+
+	lc.Update(1, "uno")
+	lc.Delete("two")
+	waitFor(t, 2*time.Second, func() bool {
+		item, ok := fc.Get(1)
+		_, deleted := fc.Get("two")
+		return ok && *item.Data == "uno" && !deleted
+	})
+	if f.Stats().Applied != 2 {
+		t.Errorf("expected 2 mutations applied; got %d", f.Stats().Applied)
+	}
+	waitFor(t, 2*time.Second, func() bool { return f.Stats().SeqLag() == 0 })
+
+	// force a disconnect and mutate the leader while the follower is away
+	f.mu.Lock()
+	f.conn.Close()
+	f.mu.Unlock()
+	three := "three"
+	lc.Cache(3, &three)
+	waitFor(t, 2*time.Second, func() bool {
+		_, ok := fc.Get(3)
+		return ok && f.Stats().Syncs >= 2
+	})
+}
+
+func TestReplicationUnknownStore(t *testing.T) {
+	leader := New().WithServer("replication_unknown", WithPort(8202), WithSilence(), WithReplication())
+	leader.Server().ListenAndServe()
+	defer leader.Server().Shutdown()
+
+	f := NewFollower(New(), leader.Server().URL(), WithReconnectInterval(20*time.Millisecond)).
+		Follow("replication_missing", "replication_missing_local")
+	f.Start()
+	time.Sleep(100 * time.Millisecond)
+	if f.Stats().Connected {
+		t.Error("expected follower not to connect to a store the leader does not own")
+	}
+	f.Stop()
+}
+
+func TestReplicaApplyErrors(t *testing.T) {
+	c := newCache[string]()
+	if err := c.AddIndex("name", func(s string) any { return s }, WithUniqueIndex()); err != nil {
+		t.Fatal(err)
+	}
+	name := "bob"
+	c.Cache("a", &name)
+
+	// a write rejected by a unique index is returned rather than dropped
+	k, _ := encodeKey(CacheKey("b"))
+	raw, _ := json.Marshal(Item[string]{Data: &name, Version: 1})
+	if err := c.applyMutation(opCache, k, raw); err == nil {
+		t.Error("expected unique index error from mutation")
+	}
+	ka, _ := encodeKey(CacheKey("a"))
+	if err := c.applySnapshot([]wireItem{{Key: ka, Item: raw}, {Key: k, Item: raw}}); err == nil {
+		t.Error("expected unique index error from snapshot")
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected rejected item not to be cached")
+	}
+}
+
+func TestReplicationOptIn(t *testing.T) {
+	m := New().WithServer("replication_disabled", WithPort(8221), WithSilence())
+	rec := httptest.NewRecorder()
+	m.Server().http.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/replication_disabled/replicate", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected replicate route not to be served without WithReplication; got %d", rec.Code)
+	}
+}
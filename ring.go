@@ -0,0 +1,103 @@
+package mnemo
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+type (
+	// HashRing assigns keys to nodes by consistent hashing.
+	//
+	// Each node is placed on the ring at a number of virtual points so keys
+	// are spread evenly and only a fraction of keys move when nodes join or leave.
+	HashRing struct {
+		mu     sync.RWMutex
+		vnodes int
+		points []uint32
+		owners map[uint32]string
+		nodes  map[string]bool
+	}
+)
+
+// NewHashRing creates an empty ring that places each node at vnodes virtual points.
+func NewHashRing(vnodes int) *HashRing {
+	if vnodes < 1 {
+		vnodes = 1
+	}
+	return &HashRing{
+		vnodes: vnodes,
+		owners: make(map[uint32]string),
+		nodes:  make(map[string]bool),
+	}
+}
+
+// Add adds nodes to the ring.
+func (r *HashRing) Add(ids ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		if r.nodes[id] {
+			continue
+		}
+		r.nodes[id] = true
+		for i := 0; i < r.vnodes; i++ {
+			h := ringHash(id + "#" + strconv.Itoa(i))
+			r.owners[h] = id
+			r.points = append(r.points, h)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// Remove removes nodes from the ring.
+func (r *HashRing) Remove(ids ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		delete(r.nodes, id)
+	}
+	points := r.points[:0]
+	for _, p := range r.points {
+		if r.nodes[r.owners[p]] {
+			points = append(points, p)
+		} else {
+			delete(r.owners, p)
+		}
+	}
+	r.points = points
+}
+
+// Owner returns the node that owns key, or false if the ring is empty.
+func (r *HashRing) Owner(key string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.points) == 0 {
+		return "", false
+	}
+	h := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]], true
+}
+
+// Nodes returns the ids of the nodes on the ring.
+func (r *HashRing) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]string, 0, len(r.nodes))
+	for id := range r.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func ringHash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -0,0 +1,189 @@
+package mnemo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+type (
+	// undoLog is a bounded journal of local mutations that can be undone.
+	undoLog[T any] struct {
+		limit   int
+		entries []mutation[T]
+		cancel  func()
+		// undoing is set while an undo is applied so it is not journaled itself.
+		undoing bool
+	}
+)
+
+// EnableUndo journals the last limit local mutations of the cache so they can be undone with Undo.
+//
+// Mutations replicated from other instances, loaded by the cache's loader or
+// removed by a timeout are not journaled. It returns an error if limit is not positive.
+func (c *Cache[T]) EnableUndo(limit int) error {
+	if limit <= 0 {
+		return NewError[Cache[T]](fmt.Sprintf("undo limit must be greater than 0. Got: %d", limit))
+	}
+	u := &undoLog[T]{limit: limit}
+	c.mu.Lock()
+	prev := c.undo
+	c.undo = u
+	u.cancel = c.listenLocked(func(m mutation[T]) {
+		if u.undoing || m.Source != sourceLocal {
+			return
+		}
+		u.entries = append(u.entries, m)
+		if len(u.entries) > u.limit {
+			u.entries = u.entries[len(u.entries)-u.limit:]
+		}
+	})
+	c.mu.Unlock()
+	if prev != nil {
+		prev.cancel()
+	}
+	return nil
+}
+
+// Undo reverts the last n journaled mutations and returns how many were reverted.
+//
+// The reverted mutations are applied at once, so they produce a single history
+// entry and feed update, and are removed from the journal. Undo fails if
+// EnableUndo has not been called.
+func (c *Cache[T]) Undo(n int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.undo == nil {
+		return 0, NewError[Cache[T]]("undo is not enabled")
+	}
+	u := c.undo
+	n = min(n, len(u.entries))
+	if n <= 0 {
+		return 0, nil
+	}
+
+	// revert newest first, so the oldest mutation of each key decides its final state
+	undone := u.entries[len(u.entries)-n:]
+	staged := make(map[CacheKey]txWrite)
+	var keys []CacheKey
+	for i := len(undone) - 1; i >= 0; i-- {
+		m := undone[i]
+		if _, ok := staged[m.Key]; !ok {
+			keys = append(keys, m.Key)
+		}
+		if m.Prev == nil {
+			staged[m.Key] = txWrite{delete: true}
+			continue
+		}
+		staged[m.Key] = txWrite{data: m.Prev.Data}
+	}
+	writes := make([]txWrite, 0, len(keys))
+	applied := keys[:0]
+	for _, key := range keys {
+		w := staged[key]
+		if _, ok := c.raw.caches[key]; w.delete && !ok {
+			continue
+		}
+		applied = append(applied, key)
+		writes = append(writes, w)
+	}
+
+	u.undoing = true
+	err := c.applyBatch(applied, writes)
+	u.undoing = false
+	if err != nil {
+		return 0, err
+	}
+	u.entries = u.entries[:len(u.entries)-n]
+	return n, nil
+}
+
+// RollbackTo restores the cache to its state at t, which is the latest history
+// entry recorded at or before t.
+//
+// The rollback is a single local write, so it is recorded in history, pushed to
+// feeds and written to the cache's sink.
+func (c *Cache[T]) RollbackTo(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entryAt(t)
+	if !ok {
+		return NewError[Cache[T]](fmt.Sprintf("no history at %v", t))
+	}
+	return c.restoreState(c.raw.history[e.at])
+}
+
+// RollbackToSeq restores the cache to the latest history entry that includes
+// no mutation after seq.
+func (c *Cache[T]) RollbackToSeq(seq uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// first entry after seq
+	i := sort.Search(len(c.raw.index), func(i int) bool {
+		return c.raw.index[i].seq > seq
+	})
+	if i == 0 {
+		return NewError[Cache[T]](fmt.Sprintf("no history at sequence %d", seq))
+	}
+	return c.restoreState(c.raw.history[c.raw.index[i-1].at])
+}
+
+// Restore caches a deleted key again with its latest data in history.
+func (c *Cache[T]) Restore(key CacheKey) (Item[T], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.raw.caches[key]; ok {
+		return *new(Item[T]), NewError[Cache[T]](fmt.Sprintf("key '%v' is cached", key))
+	}
+	for i := len(c.raw.index) - 1; i >= 0; i-- {
+		item, ok := c.raw.history[c.raw.index[i].at][key]
+		if !ok {
+			continue
+		}
+		if err := c.applyBatch([]CacheKey{key}, []txWrite{{data: item.Data}}); err != nil {
+			return *new(Item[T]), err
+		}
+		return *c.raw.caches[key], nil
+	}
+	return *new(Item[T]), NewError[Cache[T]](fmt.Sprintf("no history of key '%v'", key))
+}
+
+// restoreState writes the difference between the cache and a history entry.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) restoreState(state map[CacheKey]Item[T]) error {
+	var keys []CacheKey
+	var writes []txWrite
+	for key := range c.raw.caches {
+		if _, ok := state[key]; !ok {
+			keys = append(keys, key)
+			writes = append(writes, txWrite{delete: true})
+		}
+	}
+	for key, item := range state {
+		if cur, ok := c.raw.caches[key]; ok && reflect.DeepEqual(cur.Data, item.Data) {
+			continue
+		}
+		keys = append(keys, key)
+		writes = append(writes, txWrite{data: item.Data})
+	}
+	return c.applyBatch(keys, writes)
+}
+
+// applyBatch applies writes to keys at once, as a transaction does, so that
+// either all or none of them are applied.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) applyBatch(keys []CacheKey, writes []txWrite) error {
+	if err := c.checkWrites(keys, writes); err != nil {
+		return err
+	}
+	if err := c.writeThrough(keys, writes); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		c.applyWrite(key, writes[i])
+	}
+	return nil
+}
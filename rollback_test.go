@@ -0,0 +1,131 @@
+package mnemo
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUndo(t *testing.T) {
+	cache := newCache[int]()
+	if _, err := cache.Undo(1); err == nil {
+		t.Error("expected error when undo is not enabled")
+	}
+	if err := cache.EnableUndo(-1); err == nil {
+		t.Error("expected error for negative undo limit")
+	}
+	if err := cache.EnableUndo(3); err != nil {
+		t.Fatal(err)
+	}
+	cache.Set("a", 1)
+	cache.Set("a", 2)
+	cache.Set("b", 3)
+	cache.Delete("a")
+
+	// the journal only holds the last 3 mutations
+	n, err := cache.Undo(10)
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 mutations undone; got %d, %v", n, err)
+	}
+	item, ok := cache.Get("a")
+	if !ok || *item.Data != 1 {
+		t.Errorf("expected 'a' to be restored to 1; got %v", item.Data)
+	}
+	if _, ok := cache.Get("b"); ok {
+		t.Error("expected 'b' to be removed")
+	}
+	if n, _ := cache.Undo(1); n != 0 {
+		t.Error("expected undone mutations to be removed from the journal")
+	}
+
+	cache.Set("a", 5)
+	cache.Undo(1)
+	if item, _ := cache.Get("a"); *item.Data != 1 || item.Version != 3 {
+		t.Errorf("expected undo to be a new version of the item; got %d at version %d", *item.Data, item.Version)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	cache := newCache[int]()
+	cache.SetReducer(cache.DefaultReducer)
+	feed := cache.ReducerFeed()
+	<-feed
+	times := recordHistory(t, cache, "a", 1, 2)
+	cache.Set("b", 3)
+	<-feed
+
+	if err := cache.RollbackTo(times[0]); err != nil {
+		t.Fatal(err)
+	}
+	all := cache.GetAll()
+	if len(all) != 1 || *all["a"].Data != 1 {
+		t.Errorf("expected state at time; got %v", all)
+	}
+	select {
+	case f := <-feed:
+		if len(f.Cache) != 1 {
+			t.Errorf("expected rollback in feed; got %v", f.Cache)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected rollback to be pushed to feed")
+	}
+	if snap, _ := cache.At(time.Now()); len(snap.Raw) != 1 {
+		t.Error("expected rollback to be recorded in history")
+	}
+	if err := cache.RollbackTo(time.Time{}); err == nil {
+		t.Error("expected error for time before history")
+	}
+
+	snap, _ := cache.At(times[1])
+	if err := cache.RollbackToSeq(snap.Seq); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := cache.Get("a"); *item.Data != 2 {
+		t.Errorf("expected state at sequence; got %d", *item.Data)
+	}
+}
+
+func TestRollbackWriteThrough(t *testing.T) {
+	cache := newCache[int]()
+	cache.SetReducer(cache.DefaultReducer)
+	<-cache.ReducerFeed()
+	times := recordHistory(t, cache, "a", 1, 2)
+	sink := NewMemorySink[int]()
+	cache.SetSink(sink)
+	defer cache.CloseSink()
+
+	sink.SetError(errors.New("unavailable"))
+	if err := cache.RollbackTo(times[0]); err == nil {
+		t.Error("expected rollback to fail when the sink rejects it")
+	}
+	if item, _ := cache.Get("a"); *item.Data != 2 {
+		t.Error("expected failed rollback not to be applied")
+	}
+	sink.SetError(nil)
+	cache.RollbackTo(times[0])
+	if r := sink.Records(); len(r) != 1 || *r[0].Item.Data != 1 {
+		t.Errorf("expected rollback to be written through; got %v", r)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	cache := newCache[int]()
+	cache.SetReducer(cache.DefaultReducer)
+	<-cache.ReducerFeed()
+	recordHistory(t, cache, "a", 1, 2)
+	cache.Delete("a")
+
+	item, err := cache.Restore("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *item.Data != 2 {
+		t.Errorf("expected latest data in history; got %d", *item.Data)
+	}
+	if _, err := cache.Restore("a"); err == nil {
+		t.Error("expected error restoring a cached key")
+	}
+	if _, err := cache.Restore("missing"); err == nil {
+		t.Error("expected error restoring a key with no history")
+	}
+}
@@ -0,0 +1,419 @@
+package mnemo
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MissedSkip skips missed runs and waits for the next scheduled run.
+	MissedSkip MissedRunPolicy = iota
+	// MissedRunOnce runs a command once for any number of missed runs.
+	MissedRunOnce
+	// MissedRunAll runs a command once for every missed run.
+	MissedRunAll
+)
+
+// maxMissedRuns bounds the missed runs counted at once.
+const maxMissedRuns = 1000
+
+type (
+	// Trigger decides when a scheduled command runs.
+	Trigger interface {
+		// Next returns the first run after t, or the zero time if there is none.
+		Next(t time.Time) time.Time
+	}
+	// MissedRunPolicy decides what happens to runs missed while a schedule was
+	// paused, its previous run was still running or it fell behind.
+	MissedRunPolicy int
+	// ScheduleID is a unique identifier for a schedule.
+	ScheduleID string
+	// ScheduleConfig configures a schedule.
+	ScheduleConfig struct {
+		// Args are the arguments the command is run with.
+		Args any
+		// Jitter is the maximum random delay added to each run.
+		Jitter time.Duration
+		// Overlap allows a run to start while the previous run is still running.
+		Overlap bool
+		// Missed decides what happens to missed runs.
+		Missed MissedRunPolicy
+	}
+	// ScheduleInfo is the state of a schedule.
+	ScheduleInfo struct {
+		ID      ScheduleID `json:"id"`
+		Command CommandKey `json:"command"`
+		// Next is the next scheduled run, or the zero time if there are no more runs.
+		Next      time.Time `json:"next"`
+		LastRun   time.Time `json:"last_run"`
+		LastError string    `json:"last_error,omitempty"`
+		Runs      int       `json:"runs"`
+		Missed    int       `json:"missed"`
+		Paused    bool      `json:"paused"`
+		Running   bool      `json:"running"`
+	}
+	// schedule runs a command whenever its trigger fires.
+	schedule struct {
+		mu       sync.Mutex
+		cmds     *Commands
+		trigger  Trigger
+		cfg      ScheduleConfig
+		info     ScheduleInfo
+		jitter   time.Duration
+		running  int
+		pending  int
+		resumed  bool
+		created  time.Time
+		ctx      context.Context
+		cancel   context.CancelFunc
+		wake     chan struct{}
+		finished chan struct{}
+	}
+	// every triggers at a fixed interval.
+	every time.Duration
+	// once triggers at a single time.
+	once time.Time
+)
+
+// Every returns a trigger that fires every d, starting d after the schedule is added.
+func Every(d time.Duration) Trigger {
+	return every(d)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	if e <= 0 {
+		return time.Time{}
+	}
+	return t.Add(time.Duration(e))
+}
+
+// Once returns a trigger that fires once at t.
+func Once(t time.Time) Trigger {
+	return once(t)
+}
+
+func (o once) Next(t time.Time) time.Time {
+	if time.Time(o).After(t) {
+		return time.Time(o)
+	}
+	return time.Time{}
+}
+
+// WithScheduleArgs sets the arguments a scheduled command is run with.
+func WithScheduleArgs(args any) Opt[ScheduleConfig] {
+	return func(c *ScheduleConfig) {
+		c.Args = args
+	}
+}
+
+// WithJitter delays each run of a schedule by a random duration up to d.
+func WithJitter(d time.Duration) Opt[ScheduleConfig] {
+	return func(c *ScheduleConfig) {
+		c.Jitter = d
+	}
+}
+
+// WithOverlap allows a scheduled run to start while the previous run is still
+// running. By default such runs are missed.
+func WithOverlap() Opt[ScheduleConfig] {
+	return func(c *ScheduleConfig) {
+		c.Overlap = true
+	}
+}
+
+// WithMissedRuns sets what happens to missed runs of a schedule. The default is MissedSkip.
+func WithMissedRuns(p MissedRunPolicy) Opt[ScheduleConfig] {
+	return func(c *ScheduleConfig) {
+		c.Missed = p
+	}
+}
+
+// AddSchedule runs a command every time trigger fires until the schedule is removed.
+//
+// Runs are executed as Execute does, so they are bounded by the command's timeout.
+func (c *Commands) AddSchedule(key CommandKey, trigger Trigger, opts ...Opt[ScheduleConfig]) (ScheduleID, error) {
+	if _, err := c.get(key); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	next := trigger.Next(now)
+	if next.IsZero() {
+		return "", NewError[Commands](fmt.Sprintf("schedule of command '%v' has no future runs", key))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &schedule{
+		cmds:    c,
+		trigger: trigger,
+		info: ScheduleInfo{
+			ID:      ScheduleID(uuid.New().String()),
+			Command: key,
+			Next:    next,
+		},
+		created:  now,
+		ctx:      ctx,
+		cancel:   cancel,
+		wake:     make(chan struct{}, 1),
+		finished: make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(&s.cfg)
+	}
+	s.jitter = s.randomJitter()
+
+	c.mu.Lock()
+	if c.schedules == nil {
+		c.schedules = make(map[ScheduleID]*schedule)
+	}
+	c.schedules[s.info.ID] = s
+	c.mu.Unlock()
+	go s.loop()
+	return s.info.ID, nil
+}
+
+// Schedule returns a schedule by id.
+func (c *Commands) Schedule(id ScheduleID) (ScheduleInfo, bool) {
+	s, err := c.schedule(id)
+	if err != nil {
+		return ScheduleInfo{}, false
+	}
+	return s.state(), true
+}
+
+// Schedules returns every schedule of the collection in the order they were added.
+func (c *Commands) Schedules() []ScheduleInfo {
+	c.mu.Lock()
+	list := make([]*schedule, 0, len(c.schedules))
+	for _, s := range c.schedules {
+		list = append(list, s)
+	}
+	c.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].created.Before(list[j].created)
+	})
+	infos := make([]ScheduleInfo, len(list))
+	for i, s := range list {
+		infos[i] = s.state()
+	}
+	return infos
+}
+
+// PauseSchedule stops a schedule from running its command until it is resumed.
+// Runs in progress are not canceled.
+func (c *Commands) PauseSchedule(id ScheduleID) error {
+	s, err := c.schedule(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.info.Paused = true
+	s.mu.Unlock()
+	s.signal()
+	return nil
+}
+
+// ResumeSchedule resumes a paused schedule. Runs missed while it was paused
+// are handled by its missed run policy.
+func (c *Commands) ResumeSchedule(id ScheduleID) error {
+	s, err := c.schedule(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.info.Paused {
+		s.info.Paused = false
+		s.resumed = true
+		if s.pending > 0 && s.running == 0 {
+			s.pending--
+			s.start(1)
+		}
+	}
+	s.mu.Unlock()
+	s.signal()
+	return nil
+}
+
+// RemoveSchedule removes a schedule and cancels its runs in progress.
+func (c *Commands) RemoveSchedule(id ScheduleID) error {
+	c.mu.Lock()
+	s, ok := c.schedules[id]
+	delete(c.schedules, id)
+	c.mu.Unlock()
+	if !ok {
+		return NewError[Commands](fmt.Sprintf("no schedule with id '%s'", id))
+	}
+	s.cancel()
+	<-s.finished
+	return nil
+}
+
+// schedule returns a schedule by id.
+func (c *Commands) schedule(id ScheduleID) (*schedule, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.schedules[id]
+	if !ok {
+		return nil, NewError[Commands](fmt.Sprintf("no schedule with id '%s'", id))
+	}
+	return s, nil
+}
+
+// state returns the schedule's info.
+func (s *schedule) state() ScheduleInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := s.info
+	info.Running = s.running > 0
+	return info
+}
+
+// signal wakes the schedule's loop to reconsider its state.
+func (s *schedule) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop waits for each run of the schedule until it has no more runs or is removed.
+func (s *schedule) loop() {
+	defer close(s.finished)
+	for {
+		s.mu.Lock()
+		paused, next := s.info.Paused, s.info.Next
+		if next.IsZero() {
+			s.mu.Unlock()
+			return
+		}
+		wait := time.Until(next)
+		if !paused && wait > 0 {
+			// nothing was missed while the schedule was paused
+			s.resumed = false
+		}
+		wait += s.jitter
+		s.mu.Unlock()
+
+		if paused {
+			select {
+			case <-s.wake:
+				continue
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-s.wake:
+				timer.Stop()
+				continue
+			case <-s.ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		s.mu.Lock()
+		if !s.info.Paused {
+			s.due(time.Now())
+		}
+		s.mu.Unlock()
+	}
+}
+
+// due starts the runs due at now and schedules the next run.
+//
+// A single run due on time is run. Runs due at once because the schedule fell
+// behind or was paused are missed and handled by the missed run policy.
+//
+// The caller must hold s.mu.
+func (s *schedule) due(now time.Time) {
+	count := 1
+	next := s.trigger.Next(s.info.Next)
+	for !next.IsZero() && !next.After(now) {
+		if count < maxMissedRuns {
+			count++
+		}
+		next = s.trigger.Next(next)
+	}
+	s.info.Next = next
+	s.jitter = s.randomJitter()
+
+	if count == 1 && !s.resumed {
+		s.start(1)
+		return
+	}
+	s.resumed = false
+	switch s.cfg.Missed {
+	case MissedRunOnce:
+		s.info.Missed += count - 1
+		s.start(1)
+	case MissedRunAll:
+		s.start(count)
+	default:
+		s.info.Missed += count
+	}
+}
+
+// start starts n runs of the schedule's command. Runs that would overlap a run
+// in progress are missed, unless the schedule allows overlap.
+//
+// The caller must hold s.mu.
+func (s *schedule) start(n int) {
+	for ; n > 0; n-- {
+		if s.running > 0 && !s.cfg.Overlap {
+			switch s.cfg.Missed {
+			case MissedRunOnce:
+				if s.pending == 0 {
+					s.pending = 1
+					n--
+				}
+				s.info.Missed += n
+			case MissedRunAll:
+				s.pending += n
+			default:
+				s.info.Missed += n
+			}
+			return
+		}
+		s.running++
+		s.info.Runs++
+		go s.run()
+	}
+}
+
+// run runs the schedule's command once and starts a pending run when it finishes.
+func (s *schedule) run() {
+	started := time.Now()
+	_, err := s.cmds.Execute(s.ctx, s.info.Command, s.cfg.Args)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.info.LastRun = started
+	s.info.LastError = ""
+	if err != nil {
+		s.info.LastError = err.Error()
+		NewError[Commands](fmt.Sprintf("scheduled command '%v' failed: %v", s.info.Command, err)).
+			WithLogLevel(Warn).
+			Log()
+	}
+	if s.pending > 0 && !s.info.Paused && s.ctx.Err() == nil {
+		s.pending--
+		s.start(1)
+	}
+}
+
+// randomJitter returns a random delay up to the schedule's jitter.
+func (s *schedule) randomJitter() time.Duration {
+	if s.cfg.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(s.cfg.Jitter)))
+}
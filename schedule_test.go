@@ -0,0 +1,176 @@
+package mnemo
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	cmds := NewCommands()
+	var total atomic.Int64
+	cmds.Register("add", Handler(func(ctx context.Context, n int) (int, error) {
+		return int(total.Add(int64(n))), nil
+	}))
+
+	id, err := cmds.AddSchedule("add", Every(10*time.Millisecond), WithScheduleArgs(2), WithJitter(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, time.Second, func() bool {
+		info, _ := cmds.Schedule(id)
+		return info.Runs >= 3
+	})
+	if total.Load()%2 != 0 {
+		t.Errorf("expected command to run with schedule args; got total %d", total.Load())
+	}
+
+	cmds.PauseSchedule(id)
+	time.Sleep(20 * time.Millisecond)
+	paused := total.Load()
+	time.Sleep(50 * time.Millisecond)
+	if total.Load() != paused {
+		t.Error("expected paused schedule not to run")
+	}
+	if info, _ := cmds.Schedule(id); !info.Paused || info.LastRun.IsZero() {
+		t.Errorf("unexpected schedule %+v", info)
+	}
+	cmds.ResumeSchedule(id)
+	waitFor(t, time.Second, func() bool {
+		info, _ := cmds.Schedule(id)
+		return info.Missed > 0 && total.Load() > paused
+	})
+
+	if list := cmds.Schedules(); len(list) != 1 || list[0].ID != id {
+		t.Errorf("unexpected schedules %+v", list)
+	}
+	if err := cmds.RemoveSchedule(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cmds.Schedule(id); ok {
+		t.Error("expected schedule to be removed")
+	}
+	if _, err := cmds.AddSchedule("missing", Every(time.Second)); err == nil {
+		t.Error("expected error scheduling missing command")
+	}
+}
+
+func TestScheduleOnce(t *testing.T) {
+	cmds := NewCommands()
+	ran := make(chan struct{}, 2)
+	cmds.Register("once", func(ctx context.Context, args any) (any, error) {
+		ran <- struct{}{}
+		return nil, nil
+	})
+	if _, err := cmds.AddSchedule("once", Once(time.Now().Add(-time.Second))); err == nil {
+		t.Error("expected error for a trigger with no future runs")
+	}
+	id, _ := cmds.AddSchedule("once", Once(time.Now().Add(20*time.Millisecond)))
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("expected command to run")
+	}
+	waitFor(t, time.Second, func() bool {
+		info, _ := cmds.Schedule(id)
+		return info.Runs == 1 && info.Next.IsZero()
+	})
+}
+
+// fire makes a schedule's trigger fire now.
+func fire(t *testing.T, cmds *Commands, id ScheduleID) {
+	t.Helper()
+	s, err := cmds.schedule(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.due(time.Now())
+}
+
+func TestScheduleOverlap(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		opts         []Opt[ScheduleConfig]
+		overlapping  int
+		runs, missed int
+	}{
+		{name: "skip", opts: []Opt[ScheduleConfig]{WithMissedRuns(MissedSkip)}, runs: 1, missed: 2},
+		{name: "run once", opts: []Opt[ScheduleConfig]{WithMissedRuns(MissedRunOnce)}, runs: 2, missed: 1},
+		{name: "run all", opts: []Opt[ScheduleConfig]{WithMissedRuns(MissedRunAll)}, runs: 3},
+		{name: "overlap", opts: []Opt[ScheduleConfig]{WithOverlap()}, overlapping: 2, runs: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmds := NewCommands()
+			started := make(chan struct{}, 3)
+			release := make(chan struct{})
+			cmds.Register("block", func(ctx context.Context, args any) (any, error) {
+				started <- struct{}{}
+				<-release
+				return nil, nil
+			})
+			// the trigger never fires on its own, so runs are started by fire
+			id, _ := cmds.AddSchedule("block", Every(time.Hour), tc.opts...)
+			defer cmds.RemoveSchedule(id)
+			wait := func() {
+				select {
+				case <-started:
+				case <-time.After(time.Second):
+					t.Fatal("expected scheduled run to start")
+				}
+			}
+
+			fire(t, &cmds, id)
+			wait()
+			// the first run blocks through the next two runs
+			fire(t, &cmds, id)
+			fire(t, &cmds, id)
+			for i := 0; i < tc.overlapping; i++ {
+				wait()
+			}
+			if info, _ := cmds.Schedule(id); info.Runs != 1+tc.overlapping || info.Missed != tc.missed {
+				t.Errorf("unexpected schedule while blocked %+v", info)
+			}
+			close(release)
+			for i := 1 + tc.overlapping; i < tc.runs; i++ {
+				wait()
+			}
+			waitFor(t, time.Second, func() bool {
+				info, _ := cmds.Schedule(id)
+				return !info.Running
+			})
+			if info, _ := cmds.Schedule(id); info.Runs != tc.runs || info.Missed != tc.missed {
+				t.Errorf("expected %d runs and %d missed; got %+v", tc.runs, tc.missed, info)
+			}
+		})
+	}
+}
+
+func TestScheduleMissedRuns(t *testing.T) {
+	for _, policy := range []MissedRunPolicy{MissedSkip, MissedRunOnce} {
+		cmds := NewCommands()
+		var runs atomic.Int64
+		cmds.Register("count", func(ctx context.Context, args any) (any, error) {
+			runs.Add(1)
+			return nil, nil
+		})
+		id, _ := cmds.AddSchedule("count", Every(40*time.Millisecond), WithMissedRuns(policy))
+		cmds.PauseSchedule(id)
+		time.Sleep(130 * time.Millisecond)
+		cmds.ResumeSchedule(id)
+		waitFor(t, time.Second, func() bool {
+			info, _ := cmds.Schedule(id)
+			return info.Missed > 0
+		})
+		info, _ := cmds.Schedule(id)
+		if policy == MissedSkip && (info.Runs != 0 || info.Missed != 3) {
+			t.Errorf("expected missed runs to be skipped; got %+v", info)
+		}
+		if policy == MissedRunOnce && (info.Runs != 1 || info.Missed != 2) {
+			t.Errorf("expected missed runs to run once; got %+v", info)
+		}
+		cmds.RemoveSchedule(id)
+	}
+}
@@ -0,0 +1,285 @@
+package mnemo
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// Schema is a JSON Schema describing the arguments or result of a command.
+	// It supports the subset of JSON Schema needed to describe json encoded Go values,
+	// and OpenAPI's nullable to allow null in place of a value of Type.
+	Schema struct {
+		Type                 string             `json:"type,omitempty"`
+		Format               string             `json:"format,omitempty"`
+		Description          string             `json:"description,omitempty"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+		AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+		Items                *Schema            `json:"items,omitempty"`
+		Enum                 []any              `json:"enum,omitempty"`
+		Minimum              *float64           `json:"minimum,omitempty"`
+		Maximum              *float64           `json:"maximum,omitempty"`
+		MinLength            *int               `json:"minLength,omitempty"`
+		MaxLength            *int               `json:"maxLength,omitempty"`
+		Nullable             bool               `json:"nullable,omitempty"`
+	}
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// SchemaOf returns the schema of the json encoding of T.
+//
+// Struct fields are required unless they are tagged omitempty, and are
+// described by their 'description' tag. Pointers, slices and maps are nullable,
+// as their nil values encode as null. Types with their own json or text
+// encoding are described by an empty schema.
+func SchemaOf[T any]() *Schema {
+	return schemaOf(reflect.TypeOf((*T)(nil)).Elem(), map[reflect.Type]bool{})
+}
+
+func schemaOf(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	if t.Kind() != reflect.Pointer && marshals(t) {
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(schemaOf(t.Elem(), seen))
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice:
+		// only byte slices are encoded as base64 strings, byte arrays are arrays
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte", Nullable: true}
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), seen), Nullable: true}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), seen), Nullable: true}
+	case reflect.Struct:
+		// recursive types are described by an empty schema where they recur
+		if seen[t] {
+			return &Schema{}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addFields(s, t, seen)
+		return s
+	}
+	// interfaces may be any value
+	return &Schema{}
+}
+
+// marshals reports whether values of t, or pointers to them, encode themselves.
+func marshals(t reflect.Type) bool {
+	for _, mt := range []reflect.Type{jsonMarshalerType, textMarshalerType} {
+		if t.Implements(mt) || reflect.PointerTo(t).Implements(mt) {
+			return true
+		}
+	}
+	return false
+}
+
+// nullable returns a copy of s that allows null.
+func nullable(s *Schema) *Schema {
+	if s.Type == "" {
+		return s
+	}
+	c := *s
+	c.Nullable = true
+	return &c
+}
+
+// addFields adds the json encoded fields of a struct to an object schema.
+func addFields(s *Schema, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addFields(s, ft, seen)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs := schemaOf(f.Type, seen)
+		if d := f.Tag.Get("description"); d != "" {
+			c := *fs
+			c.Description = d
+			fs = &c
+		}
+		s.Properties[name] = fs
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// Validate returns an error describing the first way v does not match the
+// schema. v is compared by its json encoding.
+func (s *Schema) Validate(v any) error {
+	if s == nil {
+		return nil
+	}
+	b, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return NewError[Schema](err.Error())
+		}
+	}
+	var data any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return NewError[Schema](err.Error())
+	}
+	if err := s.validate("", data); err != nil {
+		return NewError[Schema](err.Error())
+	}
+	return nil
+}
+
+// validate validates a json decoded value at path.
+func (s *Schema) validate(path string, v any) error {
+	if s == nil || v == nil && s.Nullable {
+		return nil
+	}
+	at := func(format string, args ...any) error {
+		msg := fmt.Sprintf(format, args...)
+		if path == "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return fmt.Errorf("%s: %s", path, msg)
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(normalizeJSON(e), v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return at("must be one of %v", s.Enum)
+		}
+	}
+	if s.Type != "" && jsonType(v, s.Type) != s.Type {
+		return at("expected %s; got %s", s.Type, jsonType(v, s.Type))
+	}
+	switch v := v.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return at("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return at("must be at most %v", *s.Maximum)
+		}
+	case string:
+		n := len([]rune(v))
+		if s.MinLength != nil && n < *s.MinLength {
+			return at("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return at("must be at most %d characters", *s.MaxLength)
+		}
+	case []any:
+		for i, item := range v {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return at("missing required property '%s'", name)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			ps, ok := s.Properties[k]
+			if !ok {
+				ps = s.AdditionalProperties
+			}
+			if err := ps.validate(p, v[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonType returns the JSON Schema type of a json decoded value. Whole numbers
+// are integers if want is integer.
+func jsonType(v any, want string) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if want == "integer" && v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// normalizeJSON converts a value to its json decoded form.
+func normalizeJSON(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	json.Unmarshal(b, &out)
+	return out
+}
@@ -0,0 +1,171 @@
+package mnemo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaBase struct {
+	ID string `json:"id"`
+}
+
+type schemaArgs struct {
+	schemaBase
+	Name    string          `json:"name" description:"the user's name"`
+	Age     int             `json:"age,omitempty"`
+	Tags    []string        `json:"tags,omitempty"`
+	Meta    map[string]bool `json:"meta,omitempty"`
+	Created time.Time       `json:"created"`
+	Next    *schemaArgs     `json:"next,omitempty"`
+	Extra   any             `json:"extra,omitempty"`
+	Ignored string          `json:"-"`
+	private string
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf[schemaArgs]()
+	if s.Type != "object" || !reflect.DeepEqual(s.Required, []string{"id", "name", "created"}) {
+		t.Errorf("unexpected object schema %+v", s)
+	}
+	for name, want := range map[string]string{
+		"id": "string", "name": "string", "age": "integer", "tags": "array",
+		"meta": "object", "created": "string", "extra": "",
+	} {
+		p, ok := s.Properties[name]
+		if !ok || p.Type != want {
+			t.Errorf("expected %s to be %q; got %+v", name, want, p)
+		}
+	}
+	if _, ok := s.Properties["Ignored"]; ok {
+		t.Error("expected ignored field to be omitted")
+	}
+	if s.Properties["name"].Description != "the user's name" || s.Properties["created"].Format != "date-time" {
+		t.Errorf("unexpected property schemas %+v", s.Properties)
+	}
+	if s.Properties["tags"].Items.Type != "string" || s.Properties["meta"].AdditionalProperties.Type != "boolean" {
+		t.Errorf("unexpected collection schemas %+v", s.Properties)
+	}
+	// recursive types recur as an empty schema
+	if next := s.Properties["next"]; next == nil || next.Type != "" {
+		t.Errorf("unexpected recursive schema %+v", next)
+	}
+	if b, err := json.Marshal(SchemaOf[[]int]()); err != nil || string(b) != `{"type":"array","items":{"type":"integer"},"nullable":true}` {
+		t.Errorf("unexpected json schema %s", b)
+	}
+}
+
+type schemaText struct{}
+
+func (schemaText) MarshalText() ([]byte, error) { return []byte("text"), nil }
+
+func TestSchemaZeroValues(t *testing.T) {
+	type values struct {
+		Tags  []string
+		Meta  map[string]int
+		Next  *values
+		Bytes []byte
+		Key   [4]byte
+		Text  schemaText
+		Raw   json.RawMessage
+	}
+	s := SchemaOf[values]()
+	for _, v := range []values{{}, {Tags: []string{"a"}, Key: [4]byte{1}, Raw: json.RawMessage(`{"a":1}`)}} {
+		if err := s.Validate(v); err != nil {
+			t.Errorf("expected %+v to be valid; got %v", v, err)
+		}
+	}
+	if key := s.Properties["Key"]; key.Type != "array" || key.Items.Type != "integer" {
+		t.Errorf("expected byte arrays to be arrays; got %+v", key)
+	}
+	if text := s.Properties["Text"]; text.Type != "" {
+		t.Errorf("expected text marshalers to be unconstrained; got %+v", text)
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	min, maxLen := 1.0, 3
+	s := &Schema{
+		Type:     "object",
+		Required: []string{"name"},
+		Properties: map[string]*Schema{
+			"name":  {Type: "string", MaxLength: &maxLen},
+			"count": {Type: "integer", Minimum: &min},
+			"kind":  {Enum: []any{"a", "b"}},
+			"tags":  {Type: "array", Items: &Schema{Type: "string"}},
+		},
+	}
+	valid := []any{
+		map[string]any{"name": "ann"},
+		map[string]any{"name": "bob", "count": 2, "kind": "b", "tags": []string{"x"}},
+		json.RawMessage(`{"name":"cat","count":1.0}`),
+	}
+	for _, v := range valid {
+		if err := s.Validate(v); err != nil {
+			t.Errorf("expected %v to be valid; got %v", v, err)
+		}
+	}
+	invalid := map[string]any{
+		"missing required property 'name'": map[string]any{},
+		"name: must be at most 3":          map[string]any{"name": "dave"},
+		"count: expected integer":          map[string]any{"name": "a", "count": 1.5},
+		"count: must be at least 1":        map[string]any{"name": "a", "count": 0},
+		"kind: must be one of":             map[string]any{"name": "a", "kind": "c"},
+		"tags[1]: expected string":         map[string]any{"name": "a", "tags": []any{"x", 1}},
+		"expected object":                  "nope",
+	}
+	for want, v := range invalid {
+		if err := s.Validate(v); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error %q for %v; got %v", want, v, err)
+		}
+	}
+}
+
+func TestCommandSchemas(t *testing.T) {
+	type greetArgs struct {
+		Name string `json:"name"`
+	}
+	var key StoreKey = "schema_store"
+	store, _ := NewStore(key)
+	c := store.Commands()
+	c.Register("greet", Handler(func(ctx context.Context, args greetArgs) (string, error) {
+		return "hello " + args.Name, nil
+	}), WithDescription("Greets a user"), WithSchemas[greetArgs, string]())
+	c.Register("ping", func(ctx context.Context, args any) (any, error) {
+		return "pong", nil
+	})
+
+	list := c.List()
+	if len(list) != 2 || list[0].Key != "greet" || list[1].Key != "ping" {
+		t.Fatalf("expected commands in order of keys; got %+v", list)
+	}
+	if list[0].Description != "Greets a user" || list[0].Args.Properties["name"] == nil || list[0].Result.Type != "string" {
+		t.Errorf("unexpected command info %+v", list[0])
+	}
+
+	if err := c.Validate("greet", map[string]any{}); err == nil {
+		t.Error("expected arguments without name to be invalid")
+	}
+	_, err := c.Execute(context.Background(), "greet", map[string]any{"name": 1})
+	if e, ok := IsErrorType[Commands](err); !ok || e.Status != http.StatusBadRequest {
+		t.Errorf("expected invalid arguments to be rejected; got %v", err)
+	}
+	if result, err := c.Execute(context.Background(), "greet", greetArgs{Name: "ann"}); err != nil || result != "hello ann" {
+		t.Errorf("expected valid arguments to run; got %v, %v", result, err)
+	}
+
+	m := New().WithServer("schema", WithPort(8213), WithSilence())
+	m.WithStores(key)
+	rec := httptest.NewRecorder()
+	m.Server().HandleCommands(rec, httptest.NewRequest(http.MethodGet, "/commands?store=schema_store", nil))
+	var infos []CommandInfo
+	json.NewDecoder(rec.Body).Decode(&infos)
+	if rec.Code != http.StatusOK || len(infos) != 2 || infos[0].Args.Type != "object" {
+		t.Errorf("unexpected http response %d %+v", rec.Code, infos)
+	}
+}
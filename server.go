@@ -2,6 +2,7 @@ package mnemo
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -25,16 +26,34 @@ type (
 		mu    sync.Mutex
 		mnemo *Mnemo
 		http  *http.Server
+		mux   *http.ServeMux
 		context.Context
 		cfg             serverConfig
 		msgs            chan []byte
 		onNewConnection func(c *Conn)
+		authenticate    func(r *http.Request) (string, error)
 		connPool        *Pool
+		metrics         serverMetrics
+		collectors      []Collector
 	}
+	// principalKey is the context key of the principal of an authenticated request.
+	principalKey struct{}
 	serverConfig struct {
 		Port    int
 		Pattern string
 		Key     string
+		// Replication serves the replicate route to followers.
+		Replication bool
+		// Invalidation serves the invalidate route to invalidation peers.
+		Invalidation bool
+		// Partitioning serves the partition route to nodes of partitioned caches.
+		Partitioning bool
+		// ReplicationBuffer is the number of messages buffered per follower
+		// before the follower is disconnected and forced to resync.
+		ReplicationBuffer int
+		// Heartbeat is the interval at which followers are sent the
+		// leader's latest sequence number.
+		Heartbeat time.Duration
 	}
 )
 
@@ -74,6 +93,64 @@ func WithSilence() Opt[Server] {
 	}
 }
 
+// WithReplication serves the server's stores to followers on its replicate route.
+//
+// Followers can read every cache of every store, so servers that replicate
+// should also authenticate requests with WithAuthenticator.
+func WithReplication() Opt[Server] {
+	return func(s *Server) {
+		s.cfg.Replication = true
+	}
+}
+
+// WithInvalidation applies invalidations sent by peers to the invalidation bus
+// of the server's Mnemo instance on its invalidate route.
+//
+// Peers can delete any watched key, so servers that accept invalidations should
+// also authenticate requests with WithAuthenticator.
+func WithInvalidation() Opt[Server] {
+	return func(s *Server) {
+		s.cfg.Invalidation = true
+	}
+}
+
+// WithPartitioning serves requests forwarded by other nodes of the server's
+// Mnemo instance's partitioned caches on its partition route.
+//
+// Nodes can read and write any key of a partitioned cache, so servers that
+// partition should also authenticate requests with WithAuthenticator.
+func WithPartitioning() Opt[Server] {
+	return func(s *Server) {
+		s.cfg.Partitioning = true
+	}
+}
+
+// WithReplicationBuffer sets the number of messages buffered for each follower.
+func WithReplicationBuffer(size int) Opt[Server] {
+	return func(s *Server) {
+		s.cfg.ReplicationBuffer = size
+	}
+}
+
+// WithHeartbeat sets the interval at which followers receive heartbeats.
+func WithHeartbeat(interval time.Duration) Opt[Server] {
+	return func(s *Server) {
+		s.cfg.Heartbeat = interval
+	}
+}
+
+// WithAuthenticator authenticates every request to the server's handlers with fn.
+// fn returns the principal of the request, or an error to reject it.
+//
+// Other Mnemo instances must then be given credentials to replicate, invalidate
+// and forward partitioned requests, see WithFollowerHeader, WithPeerHeader and
+// WithForwardHeader.
+func WithAuthenticator(fn func(r *http.Request) (string, error)) Opt[Server] {
+	return func(s *Server) {
+		s.authenticate = fn
+	}
+}
+
 // NewServer creates a new server.
 //
 // The server's key must be unique. If a server with the same key
@@ -81,9 +158,11 @@ func WithSilence() Opt[Server] {
 func NewServer(key string, opts ...Opt[Server]) (*Server, error) {
 	mux := http.NewServeMux()
 	cfg := serverConfig{
-		Key:     key,
-		Port:    srvMgr.AssignPort(),
-		Pattern: "/" + key,
+		Key:               key,
+		Port:              srvMgr.AssignPort(),
+		Pattern:           "/" + key,
+		ReplicationBuffer: 4096,
+		Heartbeat:         time.Second,
 	}
 	srv := &Server{
 		http: &http.Server{
@@ -94,6 +173,7 @@ func NewServer(key string, opts ...Opt[Server]) (*Server, error) {
 			MaxHeaderBytes: 1 << 20,
 			ErrorLog:       logger.StandardLog(),
 		},
+		mux:      mux,
 		Context:  context.Background(),
 		cfg:      cfg,
 		msgs:     make(chan []byte, 16),
@@ -117,7 +197,20 @@ func NewServer(key string, opts ...Opt[Server]) (*Server, error) {
 	}
 	srvMgr.servers[srv.cfg.Port] = srv
 
-	mux.HandleFunc(srv.cfg.Pattern+"/subscribe", srv.HandleSubscribe)
+	mux.HandleFunc(srv.cfg.Pattern+"/subscribe", srv.authenticated(srv.HandleSubscribe))
+	if srv.cfg.Replication {
+		mux.HandleFunc(srv.cfg.Pattern+"/replicate", srv.authenticated(srv.HandleReplicate))
+	}
+	if srv.cfg.Invalidation {
+		mux.HandleFunc(srv.cfg.Pattern+"/invalidate", srv.authenticated(srv.HandleInvalidate))
+	}
+	if srv.cfg.Partitioning {
+		mux.HandleFunc(srv.cfg.Pattern+"/partition", srv.authenticated(srv.HandlePartition))
+	}
+	mux.HandleFunc(srv.cfg.Pattern+"/query", srv.authenticated(srv.HandleQuery))
+	mux.HandleFunc(srv.cfg.Pattern+"/jobs", srv.authenticated(srv.HandleJobs))
+	mux.HandleFunc(srv.cfg.Pattern+"/commands", srv.authenticated(srv.HandleCommands))
+	mux.HandleFunc(srv.cfg.Pattern+"/metrics", srv.authenticated(srv.HandleMetrics))
 
 	return srv, nil
 }
@@ -148,15 +241,60 @@ func (s *Server) Shutdown() error {
 	return nil
 }
 
+// URL returns the base websocket url of the server on localhost.
+func (s *Server) URL() string {
+	return fmt.Sprintf("ws://localhost:%d%s", s.cfg.Port, s.cfg.Pattern)
+}
+
+// HTTPURL returns the base http url of the server on localhost.
+func (s *Server) HTTPURL() string {
+	return fmt.Sprintf("http://localhost:%d%s", s.cfg.Port, s.cfg.Pattern)
+}
+
+// authenticated authenticates requests with the server's authenticator, if any,
+// before they are handled. The principal of an authenticated request is in its context.
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authenticate != nil {
+			principal, err := s.authenticate(r)
+			if err != nil {
+				s.metrics.rejected.Add(1)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+		}
+		s.metrics.accepted.Add(1)
+		next(w, r)
+	}
+}
+
+// principal returns the principal of an authenticated request.
+func principal(r *http.Request) string {
+	p, _ := r.Context().Value(principalKey{}).(string)
+	return p
+}
+
 // HandleSubscribe upgrades the http connection to a websocket connection
 // and adds the connection to the connection pool.
 func (s *Server) HandleSubscribe(w http.ResponseWriter, r *http.Request) {
+	principal := principal(r)
 	conn, err := NewConn(w, r)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer conn.Close()
+	conn.Principal = principal
+
+	// the connection's span is the parent of the spans of its messages
+	ctx, span := startSpan(withTraceparent(s.Context, r.Header.Get("traceparent")),
+		"mnemo.server.subscribe", Attr("remote_addr", r.RemoteAddr), Attr("principal", principal))
+	defer span.End()
+	conn.ctx = ctx
 
+	conn.onMessage = func(msg []byte) {
+		s.handleMessage(conn, msg)
+	}
 	if err := s.connPool.AddConn(conn); err != nil {
 		log.Fatal(err)
 	}
@@ -167,6 +305,57 @@ func (s *Server) HandleSubscribe(w http.ResponseWriter, r *http.Request) {
 	conn.Listen()
 }
 
+// store returns a store added to the server's Mnemo instance.
+func (s *Server) store(key StoreKey) (*Store, error) {
+	if s.mnemo == nil {
+		return nil, NewError[Server]("server has no mnemo instance")
+	}
+	store, err := UseStore(key)
+	if err != nil || !s.mnemo.hasStore(key) {
+		return nil, NewError[Server](fmt.Sprintf("no store with key '%v'", key))
+	}
+	return store, nil
+}
+
+// handleMessage handles a message sent by a subscribed websocket connection.
+//
+// Messages are json objects whose 'type' is 'query' to run a QueryRequest,
+// 'execute' to run a CommandRequest, 'commands' to list the commands of the
+// message's 'store' or 'jobs' to watch its jobs. A message's 'traceparent'
+// continues the trace of its sender.
+func (s *Server) handleMessage(c *Conn, msg []byte) {
+	var m struct {
+		Type        string   `json:"type"`
+		Store       StoreKey `json:"store"`
+		Traceparent string   `json:"traceparent"`
+	}
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return
+	}
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = s.Context
+	}
+	ctx, span := startSpan(withTraceparent(ctx, m.Traceparent), "mnemo.server.message", Attr("type", m.Type), Attr("store", m.Store))
+	if m.Type == "execute" {
+		// commands may run for a long time, so they don't block reading messages
+		go func() {
+			defer span.End()
+			s.handleExecute(ctx, c, msg)
+		}()
+		return
+	}
+	defer span.End()
+	switch m.Type {
+	case "query":
+		s.handleQuery(c, msg)
+	case "commands":
+		s.listCommands(c, m.Store)
+	case "jobs":
+		s.watchJobs(c, m.Store)
+	}
+}
+
 // SetOnNewConnection sets a user defined call back function
 // when a new connection is established.
 //
@@ -177,6 +366,11 @@ func (s *Server) SetOnNewConnection(fn func(c *Conn)) {
 
 // Publish publishes a message to all connections in the connection pool.
 func (s *Server) Publish(msg interface{}) {
+	start := time.Now()
+	defer func() {
+		s.metrics.publishes.Add(1)
+		s.metrics.pubNanos.Add(uint64(time.Since(start)))
+	}()
 	for _, conn := range s.connPool.Conns() {
 		select {
 		case conn.Messages <- msg:
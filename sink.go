@@ -0,0 +1,434 @@
+package mnemo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// WriteThrough writes to the sink before the cache is changed and fails
+	// the write if the sink returns an error.
+	//
+	// The sink is called while the cache is locked, so a slow sink blocks every
+	// reader and writer of the cache until it returns or its timeout expires.
+	WriteThrough SinkMode = iota
+	// WriteBehind queues writes and flushes them to the sink in batches in the
+	// background, retrying failed batches before moving them to a dead-letter queue.
+	WriteBehind
+)
+
+type (
+	// Sink receives the writes made to a cache, e.g. to persist them to a database.
+	Sink[T any] interface {
+		Write(ctx context.Context, records []SinkRecord[T]) error
+	}
+	// SinkRecord is a single write made to a cache.
+	SinkRecord[T any] struct {
+		// Op is one of 'cache', 'update' or 'delete'.
+		Op   string    `json:"op"`
+		Key  CacheKey  `json:"key"`
+		Item Item[T]   `json:"item"`
+		Time time.Time `json:"time"`
+	}
+	// SinkMode determines how writes are propagated to a sink.
+	SinkMode int
+	// SinkConfig configures how a cache writes to its sink.
+	SinkConfig struct {
+		Mode SinkMode
+		// Timeout bounds each call to the sink. It defaults to 500ms with
+		// WriteThrough, as the cache is locked during the call, and 10s with WriteBehind.
+		Timeout time.Duration
+		// BatchSize is the maximum number of records written behind in one call.
+		// It defaults to 100 if not positive.
+		BatchSize int
+		// FlushInterval is how often queued records are written behind.
+		// It defaults to 1s if not positive.
+		FlushInterval time.Duration
+		// Retries is how many times a failed batch is retried before it is dead-lettered.
+		// Negative values are treated as 0.
+		Retries int
+		// RetryBackoff is the wait before the first retry. It doubles on each retry.
+		RetryBackoff time.Duration
+		// DeadLetters is the maximum number of failed batches kept.
+		// Negative values are treated as 0.
+		DeadLetters int
+	}
+	// DeadLetter is a batch of records that could not be written behind.
+	DeadLetter[T any] struct {
+		Records []SinkRecord[T] `json:"records"`
+		Error   string          `json:"error"`
+		Time    time.Time       `json:"time"`
+	}
+	// sinkWriter propagates a cache's writes to its sink.
+	sinkWriter[T any] struct {
+		mu      sync.Mutex
+		sink    Sink[T]
+		cfg     SinkConfig
+		pending []SinkRecord[T]
+		dead    []DeadLetter[T]
+		// inflight counts records taken from pending but not yet written or dead-lettered.
+		inflight int
+		wake     chan struct{}
+		idle     *sync.Cond
+		stop     chan struct{}
+		done     chan struct{}
+	}
+	// MemorySink is a Sink that keeps records in memory.
+	MemorySink[T any] struct {
+		mu      sync.Mutex
+		records []SinkRecord[T]
+		err     error
+	}
+	// FileSink is a Sink that appends records to a file as newline delimited json.
+	FileSink[T any] struct {
+		mu   sync.Mutex
+		file *os.File
+	}
+)
+
+// WithSinkMode sets whether writes are propagated to the sink synchronously or in the background.
+func WithSinkMode(mode SinkMode) Opt[SinkConfig] {
+	return func(c *SinkConfig) {
+		c.Mode = mode
+	}
+}
+
+// WithSinkTimeout bounds each call to the sink. With WriteThrough the cache is
+// locked for up to d on every write.
+func WithSinkTimeout(d time.Duration) Opt[SinkConfig] {
+	return func(c *SinkConfig) {
+		c.Timeout = d
+	}
+}
+
+// WithBatchSize sets the maximum number of records written behind in one call.
+func WithBatchSize(n int) Opt[SinkConfig] {
+	return func(c *SinkConfig) {
+		c.BatchSize = n
+	}
+}
+
+// WithFlushInterval sets how often queued records are written behind.
+func WithFlushInterval(d time.Duration) Opt[SinkConfig] {
+	return func(c *SinkConfig) {
+		c.FlushInterval = d
+	}
+}
+
+// WithRetries sets how many times a failed batch is retried and the initial backoff between retries.
+func WithRetries(n int, backoff time.Duration) Opt[SinkConfig] {
+	return func(c *SinkConfig) {
+		c.Retries = n
+		c.RetryBackoff = backoff
+	}
+}
+
+// WithDeadLetters sets the maximum number of failed batches kept in the dead-letter queue.
+func WithDeadLetters(n int) Opt[SinkConfig] {
+	return func(c *SinkConfig) {
+		c.DeadLetters = n
+	}
+}
+
+// SetSink propagates every local write to the cache to sink.
+//
+// Items loaded by the cache's loader, replicated from other instances or
+// removed by a timeout are not written to the sink. With WriteThrough, a write
+// the sink rejects is not applied and the sink's error is returned, except by
+// Update, which logs it and returns false. A write-through sink is called while
+// the cache is locked, so it should be fast and given a short timeout.
+// Any previous sink is closed first.
+func (c *Cache[T]) SetSink(sink Sink[T], opts ...Opt[SinkConfig]) {
+	cfg := SinkConfig{
+		Mode:          WriteThrough,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		Retries:       3,
+		RetryBackoff:  100 * time.Millisecond,
+		DeadLetters:   100,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+		if cfg.Mode == WriteThrough {
+			cfg.Timeout = 500 * time.Millisecond
+		}
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	cfg.Retries = max(cfg.Retries, 0)
+	cfg.RetryBackoff = max(cfg.RetryBackoff, 0)
+	cfg.DeadLetters = max(cfg.DeadLetters, 0)
+	w := &sinkWriter[T]{
+		sink: sink,
+		cfg:  cfg,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	w.idle = sync.NewCond(&w.mu)
+	if cfg.Mode == WriteBehind {
+		go w.run()
+	} else {
+		close(w.done)
+	}
+
+	c.CloseSink()
+	c.mu.Lock()
+	c.sink = w
+	c.mu.Unlock()
+}
+
+// FlushSink waits until every queued write has been written behind or dead-lettered.
+func (c *Cache[T]) FlushSink(ctx context.Context) error {
+	c.mu.Lock()
+	w := c.sink
+	c.mu.Unlock()
+	if w == nil {
+		return nil
+	}
+	return w.flush(ctx)
+}
+
+// CloseSink flushes any queued writes and detaches the cache's sink.
+func (c *Cache[T]) CloseSink() {
+	c.mu.Lock()
+	w := c.sink
+	c.sink = nil
+	c.mu.Unlock()
+	if w == nil {
+		return
+	}
+	w.flush(context.Background())
+	close(w.stop)
+	<-w.done
+}
+
+// DeadLetters returns the batches that could not be written behind.
+func (c *Cache[T]) DeadLetters() []DeadLetter[T] {
+	c.mu.Lock()
+	w := c.sink
+	c.mu.Unlock()
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]DeadLetter[T]{}, w.dead...)
+}
+
+// propagate writes a local mutation to the cache's sink.
+//
+// The caller must hold c.mu.
+func (c *Cache[T]) propagate(op mutationOp, key CacheKey, item Item[T], src mutationSource) error {
+	if c.sink == nil || (src != sourceLocal && src != sourceSynced) {
+		return nil
+	}
+	r := SinkRecord[T]{Op: string(op), Key: key, Item: item, Time: time.Now()}
+	if c.sink.cfg.Mode == WriteBehind {
+		c.sink.enqueue(r)
+		return nil
+	}
+	if src == sourceSynced {
+		return nil
+	}
+	return c.sink.writeThrough([]SinkRecord[T]{r})
+}
+
+// writeThrough writes records to the sink synchronously.
+func (w *sinkWriter[T]) writeThrough(records []SinkRecord[T]) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Timeout)
+	defer cancel()
+	if err := w.sink.Write(ctx, records); err != nil {
+		return NewError[Sink[T]](err.Error())
+	}
+	return nil
+}
+
+// enqueue queues a record to be written behind.
+func (w *sinkWriter[T]) enqueue(r SinkRecord[T]) {
+	w.mu.Lock()
+	w.pending = append(w.pending, r)
+	full := len(w.pending) >= w.cfg.BatchSize
+	w.mu.Unlock()
+	if full {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run writes queued records behind until the writer is stopped.
+func (w *sinkWriter[T]) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			w.drain()
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+		w.drain()
+	}
+}
+
+// drain writes every queued record in batches.
+func (w *sinkWriter[T]) drain() {
+	for {
+		w.mu.Lock()
+		n := min(len(w.pending), w.cfg.BatchSize)
+		if n == 0 {
+			w.idle.Broadcast()
+			w.mu.Unlock()
+			return
+		}
+		batch := append([]SinkRecord[T]{}, w.pending[:n]...)
+		w.pending = w.pending[n:]
+		w.inflight += n
+		w.mu.Unlock()
+
+		err := w.writeBatch(batch)
+
+		w.mu.Lock()
+		w.inflight -= n
+		if err != nil {
+			w.dead = append(w.dead, DeadLetter[T]{Records: batch, Error: err.Error(), Time: time.Now()})
+			if len(w.dead) > w.cfg.DeadLetters {
+				w.dead = w.dead[len(w.dead)-w.cfg.DeadLetters:]
+			}
+			NewError[Sink[T]](err.Error()).Log()
+		}
+		w.mu.Unlock()
+	}
+}
+
+// writeBatch writes a batch, retrying with exponential backoff.
+func (w *sinkWriter[T]) writeBatch(batch []SinkRecord[T]) error {
+	backoff := w.cfg.RetryBackoff
+	var err error
+	for attempt := 0; attempt <= w.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			// a stopped writer dead-letters the batch rather than waiting to retry
+			select {
+			case <-w.stop:
+				return err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Timeout)
+		err = w.sink.Write(ctx, batch)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// flush waits until nothing is queued or in flight.
+func (w *sinkWriter[T]) flush(ctx context.Context) error {
+	if w.cfg.Mode != WriteBehind {
+		return nil
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	idle := make(chan struct{})
+	go func() {
+		w.mu.Lock()
+		for len(w.pending) > 0 || w.inflight > 0 {
+			select {
+			case w.wake <- struct{}{}:
+			default:
+			}
+			w.idle.Wait()
+		}
+		w.mu.Unlock()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewMemorySink returns an empty in-memory sink.
+func NewMemorySink[T any]() *MemorySink[T] {
+	return &MemorySink[T]{}
+}
+
+// Write implements the Sink interface.
+func (s *MemorySink[T]) Write(ctx context.Context, records []SinkRecord[T]) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+// Records returns the records written to the sink.
+func (s *MemorySink[T]) Records() []SinkRecord[T] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SinkRecord[T]{}, s.records...)
+}
+
+// SetError makes every subsequent write fail with err, or succeed if err is nil.
+func (s *MemorySink[T]) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// NewFileSink opens or creates a file that records are appended to.
+func NewFileSink[T any](path string) (*FileSink[T], error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, NewError[FileSink[T]](err.Error())
+	}
+	return &FileSink[T]{file: f}, nil
+}
+
+// Write implements the Sink interface.
+func (s *FileSink[T]) Write(ctx context.Context, records []SinkRecord[T]) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := bufio.NewWriter(s.file)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close closes the sink's file.
+func (s *FileSink[T]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
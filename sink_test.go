@@ -0,0 +1,315 @@
+package mnemo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteThroughSink(t *testing.T) {
+	cache := newCache[int]()
+	sink := NewMemorySink[int]()
+	cache.SetSink(sink)
+	defer cache.CloseSink()
+
+	one := 1
+	if err := cache.Cache("one", &one); err != nil {
+		t.Fatal(err)
+	}
+	cache.Update("one", 2)
+	cache.Delete("one")
+	records := sink.Records()
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records; got %d", len(records))
+	}
+	for i, op := range []string{"cache", "update", "delete"} {
+		if records[i].Op != op || records[i].Key != "one" {
+			t.Errorf("unexpected record %d: %+v", i, records[i])
+		}
+	}
+	if *records[1].Item.Data != 2 || records[1].Item.Version != 2 {
+		t.Errorf("expected update record to hold the new item; got %+v", records[1].Item)
+	}
+}
+
+func TestWriteThroughSinkFailure(t *testing.T) {
+	cache := newCache[int]()
+	sink := NewMemorySink[int]()
+	cache.SetSink(sink)
+	defer cache.CloseSink()
+
+	one := 1
+	cache.Cache("one", &one)
+	sink.SetError(errors.New("unavailable"))
+
+	two := 2
+	if err := cache.Cache("two", &two); err == nil {
+		t.Error("expected sink error")
+	}
+	if _, ok := cache.Get("two"); ok {
+		t.Error("expected rejected write not to be cached")
+	}
+	if cache.Update("one", 10) {
+		t.Error("expected rejected update to report failure")
+	}
+	if item, _ := cache.Get("one"); *item.Data != 1 {
+		t.Error("expected rejected update not to be applied")
+	}
+	if err := cache.Delete("one"); err == nil {
+		t.Error("expected sink error")
+	}
+	if _, ok := cache.Get("one"); !ok {
+		t.Error("expected rejected delete not to be applied")
+	}
+
+	if inserted, err := cache.Set("three", 3); inserted || err == nil {
+		t.Errorf("expected rejected set to return sink error; got %v, %v", inserted, err)
+	}
+	if _, err := cache.Set("one", 10); err == nil {
+		t.Error("expected rejected replacement to return sink error")
+	}
+	if inserted, err := cache.Add("three", 3); inserted || err == nil {
+		t.Errorf("expected rejected add to return sink error; got %v, %v", inserted, err)
+	}
+	if replaced, err := cache.Replace("one", 10); replaced || err == nil {
+		t.Errorf("expected rejected replace to return sink error; got %v, %v", replaced, err)
+	}
+	item, created, err := cache.GetOrCreate("three", func() int { return 3 })
+	if created || err == nil || item.Data != nil {
+		t.Errorf("expected rejected create to return sink error; got %+v, %v, %v", item, created, err)
+	}
+	if _, ok := cache.Get("three"); ok {
+		t.Error("expected rejected writes not to be cached")
+	}
+	if item, _ := cache.Get("one"); *item.Data != 1 {
+		t.Error("expected rejected replacements not to be applied")
+	}
+}
+
+// blockingSink blocks every write until its context is done.
+type blockingSink[T any] struct{}
+
+func (blockingSink[T]) Write(ctx context.Context, records []SinkRecord[T]) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWriteThroughSinkTimeout(t *testing.T) {
+	cache := newCache[int]()
+	cache.SetSink(blockingSink[int]{})
+	defer cache.CloseSink()
+
+	start := time.Now()
+	if _, err := cache.Set("one", 1); err == nil {
+		t.Error("expected timed out write to fail")
+	}
+	if d := time.Since(start); d < 400*time.Millisecond || d > 2*time.Second {
+		t.Errorf("expected write to time out after the default of 500ms; took %v", d)
+	}
+
+	cache.SetSink(blockingSink[int]{}, WithSinkTimeout(20*time.Millisecond))
+	start = time.Now()
+	cache.Set("one", 1)
+	if d := time.Since(start); d > 400*time.Millisecond {
+		t.Errorf("expected write to time out after 20ms; took %v", d)
+	}
+}
+
+func TestWriteThroughTransaction(t *testing.T) {
+	var key StoreKey = "sink_tx_store"
+	s, _ := NewStore(key)
+	cache, _ := NewCache[int](key, "a")
+	sink := NewMemorySink[int]()
+	cache.SetSink(sink)
+	defer cache.CloseSink()
+
+	sink.SetError(errors.New("unavailable"))
+	err := s.Transaction(func(tx *Tx) error {
+		return TxSet(tx, "a", "one", 1)
+	})
+	if err == nil {
+		t.Fatal("expected transaction to fail")
+	}
+	if _, ok := cache.Get("one"); ok {
+		t.Error("expected failed transaction not to be applied")
+	}
+
+	sink.SetError(nil)
+	err = s.Transaction(func(tx *Tx) error {
+		TxSet(tx, "a", "one", 1)
+		return TxSet(tx, "a", "two", 2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.Records()) != 2 {
+		t.Errorf("expected both writes to be written through; got %d", len(sink.Records()))
+	}
+}
+
+func TestWriteThroughTransactionRevert(t *testing.T) {
+	var key StoreKey = "sink_tx_revert_store"
+	s, _ := NewStore(key)
+	a, _ := NewCache[int](key, "a")
+	b, _ := NewCache[int](key, "b")
+	aSink, bSink := NewMemorySink[int](), NewMemorySink[int]()
+	a.SetSink(aSink)
+	b.SetSink(bSink)
+	defer a.CloseSink()
+	defer b.CloseSink()
+	a.Set("x", 1)
+	bSink.SetError(errors.New("unavailable"))
+
+	err := s.Transaction(func(tx *Tx) error {
+		TxSet(tx, "a", "x", 2)
+		TxSet(tx, "a", "y", 3)
+		return TxSet(tx, "b", "z", 4)
+	})
+	if err == nil {
+		t.Fatal("expected transaction to fail")
+	}
+	// replaying a's sink, which may have accepted the writes before b's
+	// rejected them, must leave it holding only what was applied
+	state := map[CacheKey]int{}
+	for _, r := range aSink.Records() {
+		if r.Op == string(opDelete) {
+			delete(state, r.Key)
+			continue
+		}
+		state[r.Key] = *r.Item.Data
+	}
+	if len(state) != 1 || state["x"] != 1 {
+		t.Errorf("expected sink to be restored to the cache's items; got %v", state)
+	}
+}
+
+func TestSinkSkipsLoadedItems(t *testing.T) {
+	cache := newCache[int]()
+	sink := NewMemorySink[int]()
+	cache.SetSink(sink)
+	defer cache.CloseSink()
+	cache.SetLoader(func(ctx context.Context, key CacheKey) (int, error) {
+		return 1, nil
+	})
+	if _, err := cache.GetOrLoad(context.Background(), "one"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.Records()) != 0 {
+		t.Error("expected loaded item not to be written to the sink")
+	}
+}
+
+func TestWriteBehindSink(t *testing.T) {
+	cache := newCache[int]()
+	sink := NewMemorySink[int]()
+	cache.SetSink(sink, WithSinkMode(WriteBehind), WithBatchSize(10), WithFlushInterval(time.Hour))
+	defer cache.CloseSink()
+
+	for i := 0; i < 25; i++ {
+		v := i
+		cache.Cache(i, &v)
+	}
+	// full batches are written without waiting for the flush interval
+	waitFor(t, time.Second, func() bool { return len(sink.Records()) >= 20 })
+
+	if err := cache.FlushSink(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.Records()) != 25 {
+		t.Errorf("expected all records after flush; got %d", len(sink.Records()))
+	}
+}
+
+func TestWriteBehindDeadLetters(t *testing.T) {
+	cache := newCache[int]()
+	sink := NewMemorySink[int]()
+	sink.SetError(errors.New("unavailable"))
+	cache.SetSink(sink,
+		WithSinkMode(WriteBehind),
+		WithFlushInterval(10*time.Millisecond),
+		WithRetries(2, time.Millisecond),
+		WithDeadLetters(1),
+	)
+	defer cache.CloseSink()
+
+	one, two := 1, 2
+	if err := cache.Cache("one", &one); err != nil {
+		t.Fatal("expected write-behind not to fail the write")
+	}
+	cache.FlushSink(context.Background())
+	cache.Cache("two", &two)
+	cache.FlushSink(context.Background())
+
+	dead := cache.DeadLetters()
+	if len(dead) != 1 {
+		t.Fatalf("expected dead-letter queue to be bounded; got %d", len(dead))
+	}
+	if dead[0].Records[0].Key != "two" || dead[0].Error != "unavailable" {
+		t.Errorf("unexpected dead letter %+v", dead[0])
+	}
+	if _, ok := cache.Get("one"); !ok {
+		t.Error("expected write to be cached")
+	}
+}
+
+func TestWriteBehindInvalidConfig(t *testing.T) {
+	cache := newCache[int]()
+	sink := NewMemorySink[int]()
+	cache.SetSink(sink,
+		WithSinkMode(WriteBehind),
+		WithBatchSize(0),
+		WithFlushInterval(0),
+		WithRetries(-1, -time.Second),
+		WithDeadLetters(-1),
+	)
+	defer cache.CloseSink()
+
+	one := 1
+	cache.Cache("one", &one)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := cache.FlushSink(ctx); err != nil {
+		t.Fatalf("expected non-positive settings to fall back to defaults; got %v", err)
+	}
+	if len(sink.Records()) != 1 {
+		t.Errorf("expected record to be written behind; got %d", len(sink.Records()))
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sink.ndjson")
+	sink, err := NewFileSink[int](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := newCache[int]()
+	cache.SetSink(sink)
+	one := 1
+	cache.Cache("one", &one)
+	cache.Delete("one")
+	cache.CloseSink()
+	sink.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var ops []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r SinkRecord[int]
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		ops = append(ops, r.Op)
+	}
+	if len(ops) != 2 || ops[0] != "cache" || ops[1] != "delete" {
+		t.Errorf("unexpected records %v", ops)
+	}
+}
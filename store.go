@@ -21,6 +21,7 @@ type (
 		mnemo    *Mnemo
 		data     map[CacheKey]any
 		commands Commands
+		audit    *AuditLog
 	}
 	// StoreKey is a unique identifier for a store.
 	StoreKey string
@@ -44,6 +45,17 @@ func (s *Store) setCache(key CacheKey, data any) {
 	s.data[key] = data
 }
 
+// caches returns a copy of the store's caches by key.
+func (s *Store) caches() map[CacheKey]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	caches := make(map[CacheKey]any, len(s.data))
+	for k, v := range s.data {
+		caches[k] = v
+	}
+	return caches
+}
+
 // NewStore creates a new store or returns an error if a store with the same key already exists.
 func NewStore(key StoreKey, opts ...Opt[Store]) (*Store, error) {
 	strMgr.mu.Lock()
@@ -68,6 +80,25 @@ func (s *Store) Commands() *Commands {
 	return &s.commands
 }
 
+// EnableAudit records every execution of the store's commands in an audit log
+// and returns it. If auditing is already enabled, the existing log is returned.
+func (s *Store) EnableAudit(opts ...Opt[AuditConfig]) *AuditLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.audit == nil {
+		s.audit = NewAuditLog(opts...)
+		s.commands.Use(s.audit.Middleware())
+	}
+	return s.audit
+}
+
+// Audit returns the store's audit log, or nil if auditing is not enabled.
+func (s *Store) Audit() *AuditLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.audit
+}
+
 // Key returns the store's key.
 func (s *Store) Key() StoreKey {
 	return s.key
@@ -0,0 +1,299 @@
+package mnemo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Tracer starts spans around cache operations, reductions, command executions
+	// and websocket messages.
+	//
+	// Implementations must be safe for concurrent use and must not block, as spans
+	// may be started while a cache is locked. They should start spans as children
+	// of ParentSpanContext and return contexts holding them with ContextWithSpan,
+	// so spans continue traces propagated from other processes.
+	Tracer interface {
+		// Start starts a span that is a child of the span in ctx and returns a
+		// context holding the new span.
+		Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+	}
+	// Span is a timed operation started by a Tracer.
+	Span interface {
+		SpanContext() SpanContext
+		SetAttributes(attrs ...Attribute)
+		RecordError(err error)
+		End()
+	}
+	// Attribute is a key value pair describing a span.
+	Attribute struct {
+		Key   string
+		Value any
+	}
+	// SpanContext identifies a span and the trace it belongs to.
+	//
+	// TraceID and SpanID are lower case hex encoded, as in a W3C traceparent.
+	SpanContext struct {
+		TraceID string
+		SpanID  string
+		Sampled bool
+	}
+	// NoopTracer is a Tracer whose spans do nothing. It is the default tracer.
+	NoopTracer struct{}
+	// noopSpan does nothing. It carries the span context of a remote span.
+	noopSpan struct {
+		sc SpanContext
+	}
+	// TraceRecorder is a Tracer that records ended spans in memory.
+	TraceRecorder struct {
+		mu    sync.Mutex
+		spans []RecordedSpan
+	}
+	// RecordedSpan is a span recorded by a TraceRecorder.
+	RecordedSpan struct {
+		Name string
+		SpanContext
+		// Parent is the span context of the span's parent, which is zero for root spans.
+		Parent     SpanContext
+		Attributes map[string]any
+		Err        error
+		Start      time.Time
+		End        time.Time
+	}
+	recordingSpan struct {
+		r     *TraceRecorder
+		mu    sync.Mutex
+		span  RecordedSpan
+		ended bool
+	}
+	// tracerHolder holds the package tracer, as atomic.Value requires a consistent type.
+	tracerHolder struct {
+		Tracer
+	}
+	spanKey struct{}
+)
+
+var tracer atomic.Value
+
+func init() {
+	tracer.Store(tracerHolder{NoopTracer{}})
+}
+
+// SetTracer sets the Tracer used by Mnemo. A nil tracer restores the NoopTracer.
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = NoopTracer{}
+	}
+	tracer.Store(tracerHolder{t})
+}
+
+// startSpan starts a span with the package tracer.
+func startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return tracer.Load().(tracerHolder).Start(ctx, name, attrs...)
+}
+
+// Attr returns an Attribute.
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// ContextWithSpan returns a copy of ctx holding span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span in ctx, or a span that does nothing if there is none.
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx holding a span context
+// propagated from another process, in place of any span in ctx.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return ContextWithSpan(ctx, noopSpan{sc})
+}
+
+// ParentSpanContext returns the span context of the span in ctx, if it is valid.
+func ParentSpanContext(ctx context.Context) (SpanContext, bool) {
+	sc := SpanFromContext(ctx).SpanContext()
+	return sc, sc.IsValid()
+}
+
+// ParseTraceparent parses a W3C traceparent header.
+func ParseTraceparent(s string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, NewError[SpanContext](fmt.Sprintf("invalid traceparent '%s'", s))
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 || !isHex(parts[1], 32) || !isHex(parts[2], 16) {
+		return SpanContext{}, NewError[SpanContext](fmt.Sprintf("invalid traceparent '%s'", s))
+	}
+	sc := SpanContext{TraceID: parts[1], SpanID: parts[2], Sampled: flags[0]&1 == 1}
+	if !sc.IsValid() {
+		return SpanContext{}, NewError[SpanContext](fmt.Sprintf("invalid traceparent '%s'", s))
+	}
+	return sc, nil
+}
+
+// isHex reports whether s is n lower case hex digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// IsValid reports whether the span context has non zero trace and span ids.
+func (sc SpanContext) IsValid() bool {
+	return len(sc.TraceID) == 32 && len(sc.SpanID) == 16 &&
+		strings.Trim(sc.TraceID, "0") != "" && strings.Trim(sc.SpanID, "0") != ""
+}
+
+// Traceparent returns the span context as a W3C traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// withTraceparent returns a copy of ctx holding the remote span context of a
+// traceparent, or ctx if it is empty or invalid.
+func withTraceparent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Start returns ctx and a span that does nothing.
+func (NoopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (s noopSpan) SpanContext() SpanContext       { return s.sc }
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)            {}
+func (noopSpan) End()                             {}
+
+// NewTraceRecorder returns a TraceRecorder.
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{}
+}
+
+// Start starts a recording span.
+func (r *TraceRecorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	s := &recordingSpan{r: r, span: RecordedSpan{
+		Name:       name,
+		Attributes: map[string]any{},
+		Start:      time.Now(),
+	}}
+	if parent, ok := ParentSpanContext(ctx); ok {
+		s.span.Parent = parent
+		s.span.TraceID = parent.TraceID
+		s.span.Sampled = parent.Sampled
+	} else {
+		s.span.TraceID = randomHex(16)
+		s.span.Sampled = true
+	}
+	s.span.SpanID = randomHex(8)
+	s.SetAttributes(attrs...)
+	return ContextWithSpan(ctx, s), s
+}
+
+// Spans returns the ended spans in the order they ended.
+func (r *TraceRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]RecordedSpan, len(r.spans))
+	copy(spans, r.spans)
+	return spans
+}
+
+// Find returns the ended spans with a name.
+func (r *TraceRecorder) Find(name string) []RecordedSpan {
+	var spans []RecordedSpan
+	for _, s := range r.Spans() {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+// Reset removes all recorded spans.
+func (r *TraceRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+func (s *recordingSpan) SpanContext() SpanContext {
+	return s.span.SpanContext
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	for _, a := range attrs {
+		s.span.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.span.Err = err
+	}
+}
+
+// End records the span. Calls after the first do nothing.
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.span.End = time.Now()
+	span := s.span
+	s.mu.Unlock()
+
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.spans = append(s.r.spans, span)
+}
+
+// randomHex returns n random bytes hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
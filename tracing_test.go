@@ -0,0 +1,224 @@
+package mnemo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTraceparent(t *testing.T) {
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("unexpected span context %+v", sc)
+	}
+	if sc.Traceparent() != tp {
+		t.Errorf("expected %s; got %s", tp, sc.Traceparent())
+	}
+	if _, err := ParseTraceparent(tp[:len(tp)-2] + "00-extra"); err == nil {
+		t.Error("expected version 00 with extra fields to be invalid")
+	}
+	// later versions may append fields
+	if _, err := ParseTraceparent("01" + tp[2:] + "-extra"); err != nil {
+		t.Errorf("expected later version to be valid; got %v", err)
+	}
+	for _, s := range []string{
+		"",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-x1",
+	} {
+		if _, err := ParseTraceparent(s); err == nil {
+			t.Errorf("expected %q to be invalid", s)
+		}
+	}
+}
+
+func TestTraceRecorder(t *testing.T) {
+	r := NewTraceRecorder()
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := r.Start(ContextWithRemoteSpanContext(context.Background(), remote), "root", Attr("a", 1))
+	_, child := r.Start(ctx, "child")
+	child.RecordError(errors.New("failed"))
+	child.End()
+	root.End()
+	root.SetAttributes(Attr("b", 2))
+	root.End()
+
+	spans := r.Spans()
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "root" {
+		t.Fatalf("expected spans in order they ended; got %+v", spans)
+	}
+	c, p := spans[0], spans[1]
+	if p.Parent != remote || p.TraceID != remote.TraceID {
+		t.Errorf("expected root to continue remote trace; got %+v", p)
+	}
+	if c.Parent != p.SpanContext || c.TraceID != p.TraceID || c.SpanID == p.SpanID {
+		t.Errorf("expected child of root; got %+v", c)
+	}
+	if c.Err == nil || p.Attributes["a"] != 1 || p.Attributes["b"] != nil || p.End.Before(p.Start) {
+		t.Errorf("unexpected recorded spans %+v", spans)
+	}
+
+	// the most recent of a local or remote span is the parent
+	ctx = ContextWithRemoteSpanContext(ctx, remote)
+	if sc, _ := ParentSpanContext(ctx); sc != remote {
+		t.Errorf("expected remote parent; got %+v", sc)
+	}
+	if _, ok := ParentSpanContext(context.Background()); ok {
+		t.Error("expected no parent")
+	}
+	r.Reset()
+	if len(r.Spans()) != 0 {
+		t.Error("expected no spans after reset")
+	}
+}
+
+// useRecorder sets a TraceRecorder as the tracer until the test ends.
+func useRecorder(t *testing.T) *TraceRecorder {
+	r := NewTraceRecorder()
+	SetTracer(r)
+	t.Cleanup(func() { SetTracer(nil) })
+	return r
+}
+
+func TestTracingCache(t *testing.T) {
+	r := useRecorder(t)
+	cache := newCache[int]()
+	cache.SetReducer(cache.DefaultReducer)
+	cache.Set("traced", 1)
+	cache.Set("traced", 2)
+	cache.Get("traced")
+	cache.Get("traced_missing")
+	cache.Delete("traced")
+
+	// other tests' caches may be mutated in the background
+	find := func(name string) []RecordedSpan {
+		var spans []RecordedSpan
+		for _, s := range r.Find(name) {
+			if k := s.Attributes["key"]; k == "traced" || k == "traced_missing" {
+				spans = append(spans, s)
+			}
+		}
+		return spans
+	}
+	for name, want := range map[string]int{
+		"mnemo.cache.insert": 1, "mnemo.cache.update": 1, "mnemo.cache.delete": 1, "mnemo.cache.get": 2,
+	} {
+		if spans := find(name); len(spans) != want {
+			t.Errorf("expected %d %s spans; got %d", want, name, len(spans))
+		}
+	}
+	if get := find("mnemo.cache.get"); len(get) == 2 && (get[0].Attributes["hit"] != true || get[1].Attributes["hit"] != false) {
+		t.Errorf("unexpected get spans %+v", get)
+	}
+	if insert := find("mnemo.cache.insert"); len(insert) == 1 && insert[0].Attributes["source"] != "local" {
+		t.Errorf("unexpected insert span %+v", insert[0])
+	}
+	waitFor(t, time.Second, func() bool { return len(r.Find("mnemo.cache.reduce")) > 0 })
+
+	// loads are children of the caller's span
+	cache.SetLoader(func(ctx context.Context, key CacheKey) (int, error) {
+		return 0, errors.New("not found")
+	})
+	ctx, span := r.Start(context.Background(), "caller")
+	cache.GetOrLoad(ctx, "b")
+	span.End()
+	load := r.Find("mnemo.cache.get_or_load")
+	if len(load) != 1 || load[0].Parent != span.SpanContext() || load[0].Err == nil {
+		t.Errorf("unexpected load span %+v", load)
+	}
+}
+
+func TestTracingCommands(t *testing.T) {
+	r := useRecorder(t)
+	c := newPipelineCommands()
+	c.Register("calc", c.Pipeline(Run("double"), Run("fail")))
+	c.Execute(context.Background(), "calc", 1)
+
+	spans := r.Find("mnemo.command.execute")
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 command spans; got %+v", spans)
+	}
+	byCommand := map[any]RecordedSpan{}
+	for _, s := range spans {
+		byCommand[s.Attributes["command"]] = s
+	}
+	calc := byCommand[CommandKey("calc")]
+	for _, key := range []CommandKey{"double", "fail"} {
+		if byCommand[key].Parent != calc.SpanContext {
+			t.Errorf("expected %s to be a child of calc; got %+v", key, byCommand[key])
+		}
+	}
+	if calc.Err == nil || byCommand[CommandKey("fail")].Err == nil || byCommand[CommandKey("double")].Err != nil {
+		t.Errorf("unexpected command errors %+v", byCommand)
+	}
+}
+
+func TestTracingServer(t *testing.T) {
+	r := useRecorder(t)
+	var key StoreKey = "tracing_store"
+	store, _ := NewStore(key)
+	store.Commands().Register("ping", func(ctx context.Context, args any) (any, error) {
+		return "pong", nil
+	}, WithRemote())
+	m := New().WithServer("tracing", WithPort(8215), WithSilence())
+	m.WithStores(key)
+	m.Server().ListenAndServe()
+	t.Cleanup(func() { m.Server().Shutdown() })
+
+	subscribe := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	message := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	var ws *websocket.Conn
+	waitForNoError(t, func() error {
+		var err error
+		ws, _, err = websocket.DefaultDialer.Dial(m.Server().URL()+"/subscribe", http.Header{"Traceparent": {subscribe}})
+		return err
+	})
+	defer ws.Close()
+	ws.WriteJSON(map[string]any{"type": "execute", "id": "c1", "store": key, "command": "ping"})
+	ws.WriteJSON(map[string]any{"type": "execute", "id": "c2", "store": key, "command": "ping", "traceparent": message})
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	for received := 0; received < 2; {
+		var resp CommandResponse
+		if err := ws.ReadJSON(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Type == "result" {
+			received++
+		}
+	}
+
+	var msgs []RecordedSpan
+	waitFor(t, time.Second, func() bool {
+		msgs = r.Find("mnemo.server.message")
+		return len(msgs) == 2
+	})
+	commands := map[SpanContext]RecordedSpan{}
+	for _, s := range r.Find("mnemo.command.execute") {
+		commands[s.Parent] = s
+	}
+	for _, msg := range msgs {
+		if _, ok := commands[msg.SpanContext]; !ok {
+			t.Errorf("expected command span to be a child of message %+v", msg)
+		}
+		if msg.TraceID == "4bf92f3577b34da6a3ce929d0e0e4736" {
+			// a message without a traceparent is a child of the connection's span
+			if msg.Parent.TraceID != msg.TraceID || msg.Parent.SpanID == "00f067aa0ba902b7" {
+				t.Errorf("expected message to be a child of the subscribe span; got %+v", msg)
+			}
+		} else if msg.Parent.Traceparent() != message {
+			t.Errorf("expected message to continue its traceparent; got %+v", msg)
+		}
+	}
+}
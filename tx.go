@@ -0,0 +1,311 @@
+package mnemo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type (
+	// Tx stages reads and writes across the caches of a store.
+	//
+	// Nothing is written to a cache until the transaction commits. Reads record
+	// the version of the item read, and the commit fails if any of those items
+	// changed in the meantime.
+	Tx struct {
+		store  *Store
+		caches map[CacheKey]transactional
+		reads  map[txRef]uint64
+		writes map[txRef]txWrite
+		order  []txRef
+	}
+	// transactional is implemented by every Cache so caches of any type
+	// can take part in a transaction.
+	transactional interface {
+		cacheID() uint64
+		lock()
+		unlock()
+		// version returns the version of an item or 0 if it does not exist.
+		// The caller must hold the lock.
+		version(key CacheKey) uint64
+		// checkWrites returns an error if staged writes would break a unique
+		// index. The caller must hold the lock.
+		checkWrites(keys []CacheKey, writes []txWrite) error
+		// writeThrough writes staged writes to a write-through sink in a single
+		// call. The caller must hold the lock.
+		writeThrough(keys []CacheKey, writes []txWrite) error
+		// revertWriteThrough writes records restoring the items staged writes
+		// would replace to a write-through sink. The caller must hold the lock.
+		revertWriteThrough(keys []CacheKey, writes []txWrite) error
+		// applyWrite applies a staged write. The caller must hold the lock.
+		applyWrite(key CacheKey, w txWrite)
+	}
+	// txRef identifies an item in a cache of the store.
+	txRef struct {
+		cache CacheKey
+		key   CacheKey
+	}
+	// txWrite is a staged write. Data is a *T for the cache's T.
+	txWrite struct {
+		delete bool
+		data   any
+	}
+)
+
+// Transaction runs fn in a transaction and commits its writes atomically.
+//
+// Every cache written by the transaction is locked for the commit, so each
+// receives a single history entry and a single feed update for the whole
+// transaction. If fn returns an error, or an item read by fn has changed
+// before the commit, no writes are applied and the error is returned.
+//
+// Write-through sinks are written cache by cache. If a sink rejects the
+// transaction's writes, the sinks that accepted them are written records
+// restoring the previous items. A failure to restore them is logged, and
+// leaves those sinks holding writes that were never applied to the caches.
+func (s *Store) Transaction(fn func(tx *Tx) error) error {
+	tx := &Tx{
+		store:  s,
+		caches: make(map[CacheKey]transactional),
+		reads:  make(map[txRef]uint64),
+		writes: make(map[txRef]txWrite),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// cache returns a cache of the transaction's store, adding it to the transaction.
+func (tx *Tx) cache(key CacheKey) (transactional, error) {
+	if c, ok := tx.caches[key]; ok {
+		return c, nil
+	}
+	data, err := tx.store.getCache(key)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := data.(transactional)
+	if !ok {
+		return nil, NewError[Tx](fmt.Sprintf("cache with key '%v' cannot be used in a transaction", key))
+	}
+	tx.caches[key] = c
+	return c, nil
+}
+
+// stage records a write, replacing any earlier write to the same item.
+func (tx *Tx) stage(ref txRef, w txWrite) {
+	if _, ok := tx.writes[ref]; !ok {
+		tx.order = append(tx.order, ref)
+	}
+	tx.writes[ref] = w
+}
+
+// commit locks every cache in the transaction, validates reads and applies writes.
+func (tx *Tx) commit() error {
+	caches := make([]transactional, 0, len(tx.caches))
+	for _, c := range tx.caches {
+		caches = append(caches, c)
+	}
+	// lock in a consistent order so concurrent transactions cannot deadlock
+	sort.Slice(caches, func(i, j int) bool { return caches[i].cacheID() < caches[j].cacheID() })
+	for _, c := range caches {
+		c.lock()
+	}
+	defer func() {
+		for _, c := range caches {
+			c.unlock()
+		}
+	}()
+
+	for ref, v := range tx.reads {
+		if tx.caches[ref.cache].version(ref.key) != v {
+			return NewError[Tx](fmt.Sprintf("conflict: item '%v' in cache '%v' changed", ref.key, ref.cache))
+		}
+	}
+	for _, ref := range tx.order {
+		if tx.writes[ref].delete && tx.caches[ref.cache].version(ref.key) == 0 {
+			return NewError[Tx](fmt.Sprintf("no item '%v' in cache '%v' to delete", ref.key, ref.cache))
+		}
+	}
+	keys := make(map[CacheKey][]CacheKey)
+	writes := make(map[CacheKey][]txWrite)
+	for _, ref := range tx.order {
+		keys[ref.cache] = append(keys[ref.cache], ref.key)
+		writes[ref.cache] = append(writes[ref.cache], tx.writes[ref])
+	}
+	for ck, c := range tx.caches {
+		if err := c.checkWrites(keys[ck], writes[ck]); err != nil {
+			return err
+		}
+	}
+	var written []CacheKey
+	for ck, c := range tx.caches {
+		if err := c.writeThrough(keys[ck], writes[ck]); err != nil {
+			for _, wk := range written {
+				if err := tx.caches[wk].revertWriteThrough(keys[wk], writes[wk]); err != nil {
+					NewError[Tx](fmt.Sprintf("could not revert sink of cache '%v': %v", wk, err)).Log()
+				}
+			}
+			return err
+		}
+		written = append(written, ck)
+	}
+	for _, ref := range tx.order {
+		tx.caches[ref.cache].applyWrite(ref.key, tx.writes[ref])
+	}
+	return nil
+}
+
+// TxGet reads an item in a transaction, including writes already staged by it.
+func TxGet[T any](tx *Tx, cache CacheKey, key CacheKey) (Item[T], bool, error) {
+	tc, err := tx.cache(cache)
+	if err != nil {
+		return *new(Item[T]), false, err
+	}
+	c, ok := tc.(*Cache[T])
+	if !ok {
+		return *new(Item[T]), false, NewError[Tx](fmt.Sprintf("cache with key '%v' is not of type '%v'", cache, new(T)))
+	}
+	ref := txRef{cache: cache, key: key}
+	if w, ok := tx.writes[ref]; ok {
+		if w.delete {
+			return *new(Item[T]), false, nil
+		}
+		return Item[T]{Data: w.data.(*T)}, true, nil
+	}
+	item, ok := c.Get(key)
+	if _, read := tx.reads[ref]; !read {
+		tx.reads[ref] = item.Version
+	}
+	return item, ok, nil
+}
+
+// TxSet stages caching or updating an item in a transaction.
+func TxSet[T any](tx *Tx, cache CacheKey, key CacheKey, data T) error {
+	tc, err := tx.cache(cache)
+	if err != nil {
+		return err
+	}
+	if _, ok := tc.(*Cache[T]); !ok {
+		return NewError[Tx](fmt.Sprintf("cache with key '%v' is not of type '%v'", cache, new(T)))
+	}
+	tx.stage(txRef{cache: cache, key: key}, txWrite{data: &data})
+	return nil
+}
+
+// TxDelete stages deleting an item in a transaction.
+//
+// The commit fails if the item does not exist.
+func TxDelete(tx *Tx, cache CacheKey, key CacheKey) error {
+	if _, err := tx.cache(cache); err != nil {
+		return err
+	}
+	tx.stage(txRef{cache: cache, key: key}, txWrite{delete: true})
+	return nil
+}
+
+// TxMove stages moving an item from one cache to another in a transaction.
+func TxMove[T any](tx *Tx, from CacheKey, to CacheKey, key CacheKey) error {
+	item, ok, err := TxGet[T](tx, from, key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return NewError[Tx](fmt.Sprintf("no item '%v' in cache '%v' to move", key, from))
+	}
+	if err := TxDelete(tx, from, key); err != nil {
+		return err
+	}
+	return TxSet(tx, to, key, *item.Data)
+}
+
+func (c *Cache[T]) cacheID() uint64 {
+	return c.id
+}
+
+func (c *Cache[T]) lock() {
+	c.mu.Lock()
+}
+
+func (c *Cache[T]) unlock() {
+	c.mu.Unlock()
+}
+
+func (c *Cache[T]) version(key CacheKey) uint64 {
+	item, ok := c.raw.caches[key]
+	if !ok {
+		return 0
+	}
+	return item.Version
+}
+
+func (c *Cache[T]) checkWrites(keys []CacheKey, writes []txWrite) error {
+	data := make([]*T, len(writes))
+	for i, w := range writes {
+		if !w.delete {
+			data[i] = w.data.(*T)
+		}
+	}
+	return c.checkIndexBatch(keys, data)
+}
+
+func (c *Cache[T]) writeThrough(keys []CacheKey, writes []txWrite) error {
+	if c.sink == nil || c.sink.cfg.Mode != WriteThrough || len(keys) == 0 {
+		return nil
+	}
+	now := time.Now()
+	records := make([]SinkRecord[T], 0, len(keys))
+	for i, key := range keys {
+		prev, ok := c.raw.caches[key]
+		switch {
+		case writes[i].delete:
+			records = append(records, SinkRecord[T]{Op: string(opDelete), Key: key, Item: *prev, Time: now})
+		case ok:
+			item := Item[T]{CreatedAt: prev.CreatedAt, UpdatedAt: now, Version: prev.Version + 1, Data: writes[i].data.(*T)}
+			records = append(records, SinkRecord[T]{Op: string(opUpdate), Key: key, Item: item, Time: now})
+		default:
+			item := Item[T]{CreatedAt: now, UpdatedAt: now, Version: 1, Data: writes[i].data.(*T)}
+			records = append(records, SinkRecord[T]{Op: string(opCache), Key: key, Item: item, Time: now})
+		}
+	}
+	return c.sink.writeThrough(records)
+}
+
+// revertWriteThrough writes records to a write-through sink that undo the
+// records written for staged writes, restoring the items they would replace.
+func (c *Cache[T]) revertWriteThrough(keys []CacheKey, writes []txWrite) error {
+	if c.sink == nil || c.sink.cfg.Mode != WriteThrough || len(keys) == 0 {
+		return nil
+	}
+	now := time.Now()
+	records := make([]SinkRecord[T], 0, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		key := keys[i]
+		prev, ok := c.raw.caches[key]
+		switch {
+		case writes[i].delete:
+			records = append(records, SinkRecord[T]{Op: string(opCache), Key: key, Item: *prev, Time: now})
+		case ok:
+			records = append(records, SinkRecord[T]{Op: string(opUpdate), Key: key, Item: *prev, Time: now})
+		default:
+			item := Item[T]{CreatedAt: now, UpdatedAt: now, Version: 1, Data: writes[i].data.(*T)}
+			records = append(records, SinkRecord[T]{Op: string(opDelete), Key: key, Item: item, Time: now})
+		}
+	}
+	return c.sink.writeThrough(records)
+}
+
+// applyWrite applies a staged write that has already been written through.
+func (c *Cache[T]) applyWrite(key CacheKey, w txWrite) {
+	if w.delete {
+		c.remove(key, sourceSynced)
+		return
+	}
+	data := w.data.(*T)
+	if prev, ok := c.raw.caches[key]; ok {
+		c.replace(key, prev, data, sourceSynced)
+		return
+	}
+	c.insert(key, data, sourceSynced)
+}
@@ -0,0 +1,116 @@
+package mnemo
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransaction(t *testing.T) {
+	var key StoreKey = "tx_store"
+	store, _ := NewStore(key)
+	pending, _ := NewCache[string](key, "pending")
+	done, _ := NewCache[string](key, "done")
+	counts, _ := NewCache[int](key, "counts")
+	task := "write tests"
+	pending.Cache(1, &task)
+
+	err := store.Transaction(func(tx *Tx) error {
+		if err := TxMove[string](tx, "pending", "done", 1); err != nil {
+			return err
+		}
+		return TxSet(tx, "counts", "done", 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pending.Get(1); ok {
+		t.Error("expected item to be removed from source cache")
+	}
+	if item, ok := done.Get(1); !ok || *item.Data != task {
+		t.Error("expected item to be moved to destination cache")
+	}
+	if item, ok := counts.Get("done"); !ok || *item.Data != 1 {
+		t.Error("expected count to be cached")
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	var key StoreKey = "tx_rollback"
+	store, _ := NewStore(key)
+	c, _ := NewCache[int](key, "numbers")
+	one := 1
+	c.Cache("one", &one)
+
+	errAbort := errors.New("abort")
+	err := store.Transaction(func(tx *Tx) error {
+		TxSet(tx, "numbers", "one", 100)
+		TxSet(tx, "numbers", "two", 2)
+		if item, _, _ := TxGet[int](tx, "numbers", "one"); *item.Data != 100 {
+			t.Error("expected transaction to read its own writes")
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Errorf("expected abort error; got %v", err)
+	}
+	if item, _ := c.Get("one"); *item.Data != 1 {
+		t.Error("expected no writes after rollback")
+	}
+
+	// an item read by the transaction changes before it commits
+	err = store.Transaction(func(tx *Tx) error {
+		item, _, _ := TxGet[int](tx, "numbers", "one")
+		c.Update("one", 5)
+		return TxSet(tx, "numbers", "one", *item.Data+1)
+	})
+	if _, ok := IsErrorType[Tx](err); !ok {
+		t.Errorf("expected conflict error; got %v", err)
+	}
+	if item, _ := c.Get("one"); *item.Data != 5 {
+		t.Error("expected conflicting write to be rolled back")
+	}
+
+	err = store.Transaction(func(tx *Tx) error {
+		TxSet(tx, "numbers", "three", 3)
+		return TxDelete(tx, "numbers", "missing")
+	})
+	if err == nil {
+		t.Error("expected error deleting missing item")
+	}
+	if _, ok := c.Get("three"); ok {
+		t.Error("expected no writes after failed commit")
+	}
+}
+
+func TestTransactionSingleFeedUpdate(t *testing.T) {
+	var key StoreKey = "tx_feed"
+	store, _ := NewStore(key)
+	c, _ := NewCache[int](key, "numbers")
+	c.SetReducer(c.DefaultReducer)
+	feed := c.ReducerFeed()
+	<-feed
+
+	err := store.Transaction(func(tx *Tx) error {
+		for i := 0; i < 10; i++ {
+			TxSet(tx, "numbers", i, i)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case f := <-feed:
+		if len(f.Cache) != 10 {
+			t.Errorf("expected feed update with all 10 items; got %d", len(f.Cache))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected feed update")
+	}
+	select {
+	case <-feed:
+		t.Error("expected a single feed update for the transaction")
+	case <-time.After(100 * time.Millisecond):
+	}
+}